@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+type AdvanceRecord struct {
+	Date      string    `json:"date"`
+	Amount    int       `json:"amount"`
+	VATRate   int       `json:"vat_rate"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AdvanceLedger struct {
+	Orders map[string][]AdvanceRecord `json:"orders"`
+}
+
+func LoadAdvances(path string) (*AdvanceLedger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &AdvanceLedger{Orders: make(map[string][]AdvanceRecord)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu rejestru zaliczek: %w", err)
+	}
+
+	var ledger AdvanceLedger
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON zaliczek: %w", err)
+	}
+	if ledger.Orders == nil {
+		ledger.Orders = make(map[string][]AdvanceRecord)
+	}
+	return &ledger, nil
+}
+
+func (l *AdvanceLedger) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji JSON zaliczek: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru zaliczek: %w", err)
+	}
+
+	return nil
+}
+
+func (l *AdvanceLedger) Add(orderID string, r AdvanceRecord) {
+	l.Orders[orderID] = append(l.Orders[orderID], r)
+}
+
+func (l *AdvanceLedger) Open(orderID string) []AdvanceRecord {
+	return l.Orders[orderID]
+}
+
+// Settle zamyka zaliczki odliczone na paragonie końcowym. Zaliczki, których
+// nie ma w deducted (np. dodane po wyliczeniu odliczeń), pozostają otwarte.
+func (l *AdvanceLedger) Settle(orderID string, deducted []AdvanceDeduction) {
+	open := l.Orders[orderID]
+	for _, d := range deducted {
+		for i, r := range open {
+			if r.deduction() == d {
+				open = append(open[:i:i], open[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(open) == 0 {
+		delete(l.Orders, orderID)
+		return
+	}
+	l.Orders[orderID] = open
+}
+
+func (l *AdvanceLedger) Deductions(orderID string) []AdvanceDeduction {
+	var out []AdvanceDeduction
+	for _, r := range l.Open(orderID) {
+		out = append(out, r.deduction())
+	}
+	return out
+}
+
+func (r AdvanceRecord) deduction() AdvanceDeduction {
+	return AdvanceDeduction{
+		Name:    fmt.Sprintf("Zaliczka z dnia %s", r.Date),
+		Amount:  r.Amount,
+		VATRate: r.VATRate,
+	}
+}
+
+func (fc *FiscalClient) sendTradvance(adv AdvanceDeduction) error {
+	nameBytes, err := encodeText(fc.enc, adv.Name)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	payload = append(payload, []byte("tradvance")...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte("na")...)
+	payload = append(payload, nameBytes...)
+	payload = append(payload, TAB)
+
+	vatRate := adv.VATRate
+	if vatRate < 0 {
+		vatRate = fc.vatRate
+	}
+	payload = append(payload, []byte(fmt.Sprintf("vt%d", vatRate))...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte(fmt.Sprintf("wa%d", adv.Amount))...)
+	payload = append(payload, TAB)
+
+	return fc.SendBytes(payload)
+}
+
+func (fc *FiscalClient) sendAdvances(ctx context.Context, receipt *Receipt) error {
+	for i, adv := range receipt.Advances {
+		if err := fc.sendTradvance(adv); err != nil {
+			return fmt.Errorf("błąd tradvance #%d: %w", i, err)
+		}
+		if err := fc.readResponse(ctx, "tradvance"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
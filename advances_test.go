@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdvanceLedgerSettle(t *testing.T) {
+	first := AdvanceRecord{Date: "2025-12-01", Amount: 10000, VATRate: 0}
+	second := AdvanceRecord{Date: "2025-12-05", Amount: 5000, VATRate: 0}
+	later := AdvanceRecord{Date: "2025-12-08", Amount: 2000, VATRate: 1}
+
+	tests := []struct {
+		name     string
+		open     []AdvanceRecord
+		deducted []AdvanceRecord
+		want     []AdvanceRecord
+	}{
+		{name: "wszystkie odliczone", open: []AdvanceRecord{first, second}, deducted: []AdvanceRecord{first, second}},
+		{name: "zaliczka dodana po odliczeniu zostaje", open: []AdvanceRecord{first, second, later}, deducted: []AdvanceRecord{first, second}, want: []AdvanceRecord{later}},
+		{name: "nic nie odliczono", open: []AdvanceRecord{first}, want: []AdvanceRecord{first}},
+		{name: "dwie jednakowe zaliczki, odliczona jedna", open: []AdvanceRecord{first, first}, deducted: []AdvanceRecord{first}, want: []AdvanceRecord{first}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &AdvanceLedger{Orders: map[string][]AdvanceRecord{"ZAM-1": tt.open}}
+			var deducted []AdvanceDeduction
+			for _, r := range tt.deducted {
+				deducted = append(deducted, r.deduction())
+			}
+
+			l.Settle("ZAM-1", deducted)
+
+			got, ok := l.Orders["ZAM-1"]
+			if len(tt.want) == 0 {
+				if ok {
+					t.Fatalf("zamówienie nadal otwarte: %+v", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("otwarte zaliczki = %+v, oczekiwano %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessSavesAdvancesAfterEachReceipt(t *testing.T) {
+	fc, _ := newFakePrinter(t, okReply)
+	s := newTestSession(t, fc, Product{Name: "Sweter", MinPrice: 150, MaxPrice: 150, Stock: 5})
+	s.cfg.Fiscal.ShippingChance = 0
+
+	steps := []struct {
+		name  string
+		trans Transaction
+		want  int
+	}{
+		{name: "zaliczka", trans: Transaction{Date: "2025-12-01", Amount: 10000, OrderID: "ZAM-1", Advance: true}, want: 1},
+		{name: "paragon końcowy", trans: Transaction{Date: "2025-12-01", Amount: 15000, OrderID: "ZAM-1", Final: true}, want: 0},
+	}
+	for _, step := range steps {
+		if _, err := s.Process(step.trans, 1, 1); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		// rejestr zapisany od razu po wydruku, bez czekania na Save
+		saved, err := LoadAdvances(s.paths.Advances)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(saved.Orders["ZAM-1"]); got != step.want {
+			t.Errorf("%s: zapisane zaliczki = %d, oczekiwano %d", step.name, got, step.want)
+		}
+	}
+}
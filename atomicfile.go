@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic zapisuje plik przez plik tymczasowy w tym samym katalogu.
+// Treść trafia na dysk (fsync) przed podmianą, więc przerwany zapis nie
+// uszkadza poprzedniej wersji. Przy keep > 0 poprzednia wersja zostaje jako
+// <plik>.1, a starsze kopie są przesuwane aż do <plik>.keep.
+func writeFileAtomic(path string, data []byte, keep int) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if keep > 0 {
+		if err := rotateBackups(path, keep); err != nil {
+			return fmt.Errorf("błąd rotacji kopii zapasowych: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// rotateBackups przesuwa kopie <plik>.1 … <plik>.keep-1 o jeden numer
+// i zachowuje bieżącą wersję pliku jako <plik>.1.
+func rotateBackups(path string, keep int) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	for i := keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	backup := path + ".1"
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// dowiązanie zachowuje poprzednią treść bez kopiowania; rename pliku
+	// tymczasowego podmienia tylko wpis katalogu
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+	return copyFile(path, backup)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir utrwala wpis katalogu po podmianie pliku. Nie wszystkie systemy
+// (np. Windows) pozwalają synchronizować katalog, więc błędy są pomijane.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
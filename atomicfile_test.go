@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name   string
+		keep   int
+		writes int
+		want   map[string]string
+	}{
+		{
+			name:   "bez kopii",
+			keep:   0,
+			writes: 3,
+			want:   map[string]string{"data.json": "3"},
+		},
+		{
+			name:   "pierwszy zapis bez kopii",
+			keep:   2,
+			writes: 1,
+			want:   map[string]string{"data.json": "1"},
+		},
+		{
+			name:   "rotacja zachowuje keep kopii",
+			keep:   2,
+			writes: 5,
+			want:   map[string]string{"data.json": "5", "data.json.1": "4", "data.json.2": "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "data.json")
+			for i := 1; i <= tt.writes; i++ {
+				if err := writeFileAtomic(path, []byte(fmt.Sprint(i)), tt.keep); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tt.want) {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("pliki = %v, oczekiwano %d (bez plików tymczasowych)", names, len(tt.want))
+			}
+			for name, content := range tt.want {
+				file := filepath.Join(dir, name)
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if string(data) != content {
+					t.Errorf("%s = %q, oczekiwano %q", name, data, content)
+				}
+				if info, err := os.Stat(file); err == nil && info.Mode().Perm() != 0644 {
+					t.Errorf("%s: uprawnienia %v, oczekiwano 0644", name, info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CaptureOpen = "open"
+	CaptureTX   = "TX"
+	CaptureRX   = "RX"
+)
+
+// CaptureRecord to jeden wpis pliku nagrania (JSON w linii): otwarcie
+// połączenia albo ramka wysłana/odebrana z treścią w hex (bez STX, CRC, ETX).
+// Odebrana ramka odrzucona przez program (np. z błędnym CRC) ma w Invalid
+// powód, a w Payload całą treść między STX a ETX, łącznie z CRC.
+type CaptureRecord struct {
+	Time    time.Time `json:"time"`
+	Dir     string    `json:"dir"`
+	Addr    string    `json:"addr,omitempty"`
+	Payload string    `json:"hex,omitempty"`
+	Invalid string    `json:"invalid,omitempty"`
+}
+
+func (r CaptureRecord) Bytes() ([]byte, error) {
+	return hex.DecodeString(r.Payload)
+}
+
+// Recorder dopisuje ruch protokołu do pliku nagrania. Każdy wpis jest
+// zapisywany od razu, więc nagranie przetrwa awarię programu.
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewRecorder(path, addr string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("błąd otwarcia pliku nagrania: %w", err)
+	}
+	r := &Recorder{f: f, enc: json.NewEncoder(f)}
+	if err := r.write(CaptureRecord{Time: time.Now(), Dir: CaptureOpen, Addr: addr}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) write(rec CaptureRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(rec); err != nil {
+		return fmt.Errorf("błąd zapisu nagrania: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) Record(dir string, payload []byte) error {
+	return r.write(CaptureRecord{Time: time.Now(), Dir: dir, Payload: hex.EncodeToString(payload)})
+}
+
+// RecordInvalid zapisuje odebraną ramkę odrzuconą z powodu reason.
+func (r *Recorder) RecordInvalid(raw []byte, reason string) error {
+	return r.write(CaptureRecord{Time: time.Now(), Dir: CaptureRX, Payload: hex.EncodeToString(raw), Invalid: reason})
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+func ReadCapture(path string) ([]CaptureRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu nagrania: %w", err)
+	}
+	defer f.Close()
+
+	var records []CaptureRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec CaptureRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("linia %d: błąd parsowania nagrania: %w", line, err)
+		}
+		switch rec.Dir {
+		case CaptureOpen, CaptureTX, CaptureRX:
+		default:
+			return nil, fmt.Errorf("linia %d: nieznany kierunek %q", line, rec.Dir)
+		}
+		if _, err := rec.Bytes(); err != nil {
+			return nil, fmt.Errorf("linia %d: nieprawidłowa treść ramki: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("błąd odczytu nagrania: %w", err)
+	}
+	return records, nil
+}
+
+// DescribeFrame dekoduje ramkę do postaci "polecenie  kl=wartość ...".
+func DescribeFrame(enc Encoding, payload []byte) string {
+	text, err := decodeText(enc, payload)
+	if err != nil {
+		text = string(payload)
+	}
+
+	cmd, fields := splitFrame(text)
+	var sb strings.Builder
+	sb.WriteString(cmd)
+	for _, f := range fields {
+		sb.WriteString("  ")
+		sb.WriteString(f)
+	}
+	return sb.String()
+}
+
+func splitFrame(text string) (string, []string) {
+	parts := strings.Split(text, string([]byte{TAB}))
+	var fields []string
+	for _, p := range parts[1:] {
+		if p == "" {
+			continue
+		}
+		if len(p) < 2 {
+			fields = append(fields, sanitizeASCII(p))
+			continue
+		}
+		fields = append(fields, p[:2]+"="+sanitizeASCII(p[2:]))
+	}
+	return sanitizeASCII(parts[0]), fields
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadFrameRecordsInvalidFrames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	recorder, err := NewRecorder(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	c := newClient(client, EncCP1250, time.Second)
+	c.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c.SetRecorder(recorder)
+	defer c.Close()
+
+	bad := MakeFrame([]byte("sdev\t"))
+	bad[len(bad)-2] ^= 1 // zmieniona cyfra CRC
+	go func() {
+		server.Write(bad)
+		server.Write(MakeFrame([]byte("sdev\t")))
+	}()
+
+	if _, err := c.ReadFrame(context.Background()); err == nil {
+		t.Fatal("oczekiwano błędu CRC")
+	}
+	if _, err := c.ReadFrame(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadCapture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("wpisy = %+v, oczekiwano otwarcia i dwóch ramek", records)
+	}
+	if got := records[1]; got.Invalid == "" || got.Payload != hex.EncodeToString(bad[1:len(bad)-1]) {
+		t.Errorf("odrzucona ramka = %+v, oczekiwano całej treści z CRC i powodu", got)
+	}
+	if got := records[2]; got.Invalid != "" || got.Payload != hex.EncodeToString([]byte("sdev\t")) {
+		t.Errorf("poprawna ramka = %+v", got)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+type CashOperation struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Amount int       `json:"amount"`
+}
+
+type ShiftLedger struct {
+	Cashier       string          `json:"cashier"`
+	Start         time.Time       `json:"start"`
+	Receipts      int             `json:"receipts"`
+	ReceiptsTotal int             `json:"receipts_total"`
+	Operations    []CashOperation `json:"operations"`
+}
+
+func LoadShift(path string) (*ShiftLedger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ShiftLedger{Start: time.Now()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu pliku zmiany: %w", err)
+	}
+
+	var shift ShiftLedger
+	if err := json.Unmarshal(data, &shift); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON zmiany: %w", err)
+	}
+	return &shift, nil
+}
+
+func (s *ShiftLedger) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji JSON zmiany: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu pliku zmiany: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ShiftLedger) AddReceipt(total int) {
+	s.Receipts++
+	s.ReceiptsTotal += total
+}
+
+func (s *ShiftLedger) AddOperation(opType string, amount int) {
+	s.Operations = append(s.Operations, CashOperation{
+		Time:   time.Now(),
+		Type:   opType,
+		Amount: amount,
+	})
+}
+
+func (s *ShiftLedger) Totals() (cashIn, cashOut int) {
+	for _, op := range s.Operations {
+		switch op.Type {
+		case "cashin":
+			cashIn += op.Amount
+		case "cashout":
+			cashOut += op.Amount
+		}
+	}
+	return cashIn, cashOut
+}
+
+func formatAmount(gr int) string {
+	sign := ""
+	if gr < 0 {
+		sign = "-"
+		gr = -gr
+	}
+	return fmt.Sprintf("%s%d,%02d", sign, gr/100, gr%100)
+}
+
+func (fc *FiscalClient) OpenDrawer() error {
+	var payload []byte
+	payload = append(payload, []byte("opendrwr")...)
+	payload = append(payload, TAB)
+
+	_, err := fc.query(context.Background(), "opendrwr", payload)
+	return err
+}
+
+func (fc *FiscalClient) CashIn(amount int) error {
+	return fc.cashOperation("cashin", amount)
+}
+
+func (fc *FiscalClient) CashOut(amount int) error {
+	return fc.cashOperation("cashout", amount)
+}
+
+func (fc *FiscalClient) cashOperation(cmd string, amount int) error {
+	if amount <= 0 {
+		return fmt.Errorf("kwota %s musi być dodatnia: %d", cmd, amount)
+	}
+
+	var payload []byte
+	payload = append(payload, []byte(cmd)...)
+	payload = append(payload, TAB)
+	payload = append(payload, []byte(fmt.Sprintf("wa%d", amount))...)
+	payload = append(payload, TAB)
+
+	_, err := fc.query(context.Background(), cmd, payload)
+	return err
+}
+
+func (fc *FiscalClient) ShiftReport(shift *ShiftLedger, end time.Time) error {
+	form, err := fc.Form200Start(-1, "")
+	if err != nil {
+		return fmt.Errorf("błąd formstart: %w", err)
+	}
+
+	cashIn, cashOut := shift.Totals()
+	lines := []string{
+		"RAPORT ZMIANY",
+		"Kasjer: " + shift.Cashier,
+		"Początek: " + shift.Start.Format("2006-01-02 15:04"),
+		"Koniec: " + end.Format("2006-01-02 15:04"),
+	}
+	for _, l := range lines {
+		if err := form.FormattedLine(l, ""); err != nil {
+			return err
+		}
+	}
+	if err := form.Cmd(1); err != nil {
+		return err
+	}
+
+	summary := []string{
+		fmt.Sprintf("Paragony: %d", shift.Receipts),
+		"Sprzedaż: " + formatAmount(shift.ReceiptsTotal),
+		"Wpłaty: " + formatAmount(cashIn),
+		"Wypłaty: " + formatAmount(cashOut),
+	}
+	for _, l := range summary {
+		if err := form.FormattedLine(l, ""); err != nil {
+			return err
+		}
+	}
+
+	if len(shift.Operations) > 0 {
+		if err := form.Cmd(1); err != nil {
+			return err
+		}
+		for _, op := range shift.Operations {
+			name := "Wpłata"
+			if op.Type == "cashout" {
+				name = "Wypłata"
+			}
+			if err := form.TinyLine(fmt.Sprintf("%s %s %s", op.Time.Format("15:04"), name, formatAmount(op.Amount))); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := form.Cmd(1); err != nil {
+		return err
+	}
+	if err := form.FormattedLine("Saldo wpłat/wypłat: "+formatAmount(cashIn-cashOut), ""); err != nil {
+		return err
+	}
+
+	if err := form.End(); err != nil {
+		return fmt.Errorf("błąd formend: %w", err)
+	}
+
+	return fc.drainResponses(1500 * time.Millisecond)
+}
+
+func (fc *FiscalClient) drainResponses(wait time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	for {
+		resp, err := fc.ReadFrame(ctx)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return nil
+			}
+			return err
+		}
+		if name, _ := parseResponse(resp); name == "?" {
+			return fmt.Errorf("błąd wykonania formatki: %s", sanitizeASCII(resp))
+		}
+	}
+}
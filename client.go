@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"strings"
 	"time"
@@ -70,18 +72,19 @@ func encodeText(enc Encoding, s string) ([]byte, error) {
 	}
 }
 
+var mazoviaPL = map[rune]byte{
+	'Ą': 0x8F, 'Ć': 0x95, 'Ę': 0x90, 'Ł': 0x9C, 'Ń': 0xA5, 'Ó': 0xA0, 'Ś': 0x98, 'Ź': 0xA3, 'Ż': 0xA1,
+	'ą': 0x86, 'ć': 0x8D, 'ę': 0x91, 'ł': 0x92, 'ń': 0xA4, 'ó': 0xA2, 'ś': 0x9E, 'ź': 0xA6, 'ż': 0xA7,
+}
+
 func encodeMazoviaPL(s string) []byte {
-	m := map[rune]byte{
-		'Ą': 0x8F, 'Ć': 0x95, 'Ę': 0x90, 'Ł': 0x9C, 'Ń': 0xA5, 'Ó': 0xA0, 'Ś': 0x98, 'Ź': 0xA3, 'Ż': 0xA1,
-		'ą': 0x86, 'ć': 0x8D, 'ę': 0x91, 'ł': 0x92, 'ń': 0xA4, 'ó': 0xA2, 'ś': 0x9E, 'ź': 0xA6, 'ż': 0xA7,
-	}
 	out := make([]byte, 0, len(s))
 	for _, r := range s {
 		if r <= 0x7F {
 			out = append(out, byte(r))
 			continue
 		}
-		if b, ok := m[r]; ok {
+		if b, ok := mazoviaPL[r]; ok {
 			out = append(out, b)
 			continue
 		}
@@ -90,6 +93,51 @@ func encodeMazoviaPL(s string) []byte {
 	return out
 }
 
+func decodeText(enc Encoding, b []byte) (string, error) {
+	switch enc {
+	case EncASCII:
+		return string(b), nil
+
+	case EncCP1250:
+		out, err := charmap.Windows1250.NewDecoder().Bytes(b)
+		return string(out), err
+
+	case EncISO88592:
+		out, err := charmap.ISO8859_2.NewDecoder().Bytes(b)
+		return string(out), err
+
+	case EncMazovia:
+		return decodeMazoviaPL(b), nil
+
+	default:
+		return "", fmt.Errorf("unsupported encoding")
+	}
+}
+
+var mazoviaPLReverse = func() map[byte]rune {
+	rev := make(map[byte]rune, len(mazoviaPL))
+	for r, c := range mazoviaPL {
+		rev[c] = r
+	}
+	return rev
+}()
+
+func decodeMazoviaPL(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c <= 0x7F {
+			sb.WriteByte(c)
+			continue
+		}
+		if r, ok := mazoviaPLReverse[c]; ok {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
 func crc16CCITT(data []byte) uint16 {
 	var crc uint16 = 0x0000
 	for _, b := range data {
@@ -106,12 +154,15 @@ func crc16CCITT(data []byte) uint16 {
 }
 
 type Client struct {
-	conn    net.Conn
-	r       *bufio.Reader
-	enc     Encoding
-	logRX   bool
-	logTX   bool
-	timeout time.Duration
+	conn     net.Conn
+	r        *bufio.Reader
+	enc      Encoding
+	logRX    bool
+	logTX    bool
+	timeout  time.Duration
+	logger   *slog.Logger
+	lastTX   time.Time
+	recorder *Recorder
 }
 
 func Dial(ctx context.Context, addr string, enc Encoding, timeout time.Duration, logTX, logRX bool) (*Client, error) {
@@ -120,18 +171,66 @@ func Dial(ctx context.Context, addr string, enc Encoding, timeout time.Duration,
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{
+	c := newClient(conn, enc, timeout)
+	c.logTX = logTX
+	c.logRX = logRX
+	return c, nil
+}
+
+func newClient(conn net.Conn, enc Encoding, timeout time.Duration) *Client {
+	return &Client{
 		conn:    conn,
 		r:       bufio.NewReader(conn),
 		enc:     enc,
-		logRX:   logRX,
-		logTX:   logTX,
 		timeout: timeout,
+		logger:  slog.Default(),
 	}
-	return c, nil
 }
 
-func (c *Client) Close() error { return c.conn.Close() }
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// SetRecorder włącza nagrywanie wszystkich ramek do pliku nagrania;
+// Close zamyka również nagranie.
+func (c *Client) SetRecorder(r *Recorder) {
+	c.recorder = r
+}
+
+func (c *Client) record(dir string, payload []byte) {
+	if c.recorder == nil {
+		return
+	}
+	if err := c.recorder.Record(dir, payload); err != nil {
+		c.logger.Error("błąd nagrywania ramki", slog.Any("error", err))
+	}
+}
+
+// recordInvalid nagrywa odebraną ramkę raw odrzuconą z powodu cause.
+func (c *Client) recordInvalid(raw []byte, cause error) {
+	if c.recorder == nil {
+		return
+	}
+	if err := c.recorder.RecordInvalid(raw, cause.Error()); err != nil {
+		c.logger.Error("błąd nagrywania ramki", slog.Any("error", err))
+	}
+}
+
+// frameLevel zwraca poziom logowania ramek: debug, a info dla kierunku
+// włączonego przez log_tx/log_rx.
+func frameLevel(enabled bool) slog.Level {
+	if enabled {
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+func (c *Client) Close() error {
+	if c.recorder != nil {
+		c.recorder.Close()
+	}
+	return c.conn.Close()
+}
 
 func MakeFrame(payload []byte) []byte {
 	crc := crc16CCITT(payload)
@@ -147,24 +246,19 @@ func MakeFrame(payload []byte) []byte {
 }
 
 func (c *Client) Send(payloadASCII string) error {
-	payload := []byte(payloadASCII)
-
-	frame := MakeFrame(payload)
-	if c.logTX {
-		fmt.Println("TX:", sanitizeASCII(payloadASCII))
-	}
-	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
-	_, err := c.conn.Write(frame)
-	return err
+	return c.SendBytes([]byte(payloadASCII))
 }
 
 func (c *Client) SendBytes(payload []byte) error {
 	frame := MakeFrame(payload)
-	if c.logTX {
-		fmt.Println("TX(bytes):", hex.EncodeToString(payload))
-	}
+	c.logger.Log(context.Background(), frameLevel(c.logTX), "TX", payloadAttrs(c.enc, payload)...)
+	c.lastTX = time.Now()
+	c.record(CaptureTX, payload)
 	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
 	_, err := c.conn.Write(frame)
+	if err != nil {
+		c.logger.Error("błąd wysyłania ramki", slog.Any("error", err))
+	}
 	return err
 }
 
@@ -197,12 +291,32 @@ func (c *Client) ReadFrame(ctx context.Context) (string, error) {
 		buf = append(buf, ch)
 	}
 
+	// ramka trafia do nagrania także wtedy, gdy zostanie odrzucona
+	payload, err := checkFrame(buf)
+	if err != nil {
+		c.logger.Warn("odrzucona ramka", slog.Any("error", err), slog.String("hex", hex.EncodeToString(buf)))
+		c.recordInvalid(buf, err)
+		return "", err
+	}
+
+	c.record(CaptureRX, payload)
+	attrs := payloadAttrs(c.enc, payload)
+	if !c.lastTX.IsZero() {
+		attrs = append(attrs, slog.Duration("latency", time.Since(c.lastTX)))
+	}
+	c.logger.Log(ctx, frameLevel(c.logRX), "RX", attrs...)
+	return string(payload), nil
+}
+
+// checkFrame sprawdza CRC treści ramki (między STX a ETX) i zwraca ją bez
+// CRC.
+func checkFrame(buf []byte) ([]byte, error) {
 	if len(buf) < 5 {
-		return "", errors.New("frame too short")
+		return nil, errors.New("frame too short")
 	}
 	prefixPos := len(buf) - 5
 	if buf[prefixPos] != crcPrefix {
-		return "", errors.New("CRC prefix not found at expected position")
+		return nil, errors.New("CRC prefix not found at expected position")
 	}
 
 	payload := buf[:prefixPos]
@@ -210,19 +324,26 @@ func (c *Client) ReadFrame(ctx context.Context) (string, error) {
 
 	gotBytes, err := hex.DecodeString(crcHex)
 	if err != nil || len(gotBytes) != 2 {
-		return "", errors.New("CRC decode failed")
+		return nil, errors.New("CRC decode failed")
 	}
 	got := uint16(gotBytes[0])<<8 | uint16(gotBytes[1])
 	want := crc16CCITT(payload)
 	if got != want {
-		return "", fmt.Errorf("CRC mismatch: got %04X want %04X", got, want)
+		return nil, fmt.Errorf("CRC mismatch: got %04X want %04X", got, want)
 	}
+	return payload, nil
+}
 
-	s := string(payload)
-	if c.logRX {
-		fmt.Println("RX:", sanitizeASCII(s))
-	}
-	return s, nil
+// sendRaw wysyła treść ramki bez wyliczania CRC; emulator odtwarza tak
+// ramki odrzucone w nagraniu.
+func (c *Client) sendRaw(raw []byte) error {
+	frame := make([]byte, 0, len(raw)+2)
+	frame = append(frame, STX)
+	frame = append(frame, raw...)
+	frame = append(frame, ETX)
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(frame)
+	return err
 }
 
 func sanitizeASCII(s string) string {
@@ -231,6 +352,21 @@ func sanitizeASCII(s string) string {
 	return s
 }
 
+func parseResponse(resp string) (string, map[string]string) {
+	parts := strings.Split(resp, string([]byte{TAB}))
+	fields := make(map[string]string)
+	if len(parts) == 0 {
+		return "", fields
+	}
+	for _, p := range parts[1:] {
+		if len(p) < 2 {
+			continue
+		}
+		fields[p[:2]] = p[2:]
+	}
+	return parts[0], fields
+}
+
 type SuperForm200 struct {
 	c *Client
 }
@@ -318,3 +454,15 @@ func (f *SuperForm200) Cmd(cm int) error {
 func (f *SuperForm200) End() error {
 	return f.c.Send(fmt.Sprintf("formend%cfn200%c", TAB, TAB))
 }
+
+// Abort zamyka formularz przerwany błędem cause, aby otwarty wydruk
+// niefiskalny nie blokował drukarki przy kolejnym dokumencie.
+func (f *SuperForm200) Abort(cause error) error {
+	if errors.Is(cause, io.EOF) {
+		return fmt.Errorf("%w (formularz nie został zamknięty - utracono połączenie)", cause)
+	}
+	if err := f.End(); err != nil {
+		return fmt.Errorf("%w (błąd zamknięcia formularza: %v)", cause, err)
+	}
+	return fmt.Errorf("%w (formularz zamknięty)", cause)
+}
@@ -0,0 +1,1311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func runPrint(args []string) int {
+	fs := newFlagSet("print", "<plik.csv|katalog>")
+	configPath := configFlag(fs)
+	dataPath := dataFlag(fs)
+	dryRun := dryRunFlag(fs)
+	cashier := fs.String("cashier", "", "Nazwa kasjera zapisywana w bieżącej zmianie")
+	reportPolicy := fs.String("daily-report-policy", "", "Raport dobowy po każdym dniu: ask|always|never|last-day-only (domyślnie z config.json, inaczej ask)")
+	paths := DefaultSessionPaths()
+	ledgerFlags(fs, &paths)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagana ścieżka do pliku CSV lub katalogu")
+	}
+	csvPath := fs.Arg(0)
+	paths.Data = *dataPath
+	if *reportPolicy != "" && !validReportPolicy(*reportPolicy) {
+		return usageError(fs, "nieprawidłowa polityka raportu dobowego %q", *reportPolicy)
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	policy := *reportPolicy
+	if policy == "" {
+		policy = cfg.DailyReportPolicy
+	}
+	if policy == "" {
+		policy = ReportPolicyAsk
+	}
+	if policy == ReportPolicyAsk && !*dryRun && !stdinIsTerminal() {
+		o.Warn("wejście nie jest terminalem - raporty dobowe nie będą drukowane (użyj -daily-report-policy)")
+		policy = ReportPolicyNever
+	}
+
+	o.Printf("→ Wczytuję transakcje z %s...\n", csvPath)
+	info, err := os.Stat(csvPath)
+	if err != nil {
+		return fail(o, "Błąd dostępu do %s: %v", csvPath, err)
+	}
+
+	var transactions []Transaction
+	var warnings []string
+	if info.IsDir() {
+		transactions, warnings, err = ReadCSVDirectory(csvPath)
+	} else {
+		transactions, warnings, err = ReadCSVFile(csvPath)
+	}
+	for _, w := range warnings {
+		o.Warn("%s", w)
+	}
+	if err != nil {
+		return fail(o, "Błąd parsowania CSV: %v", err)
+	}
+	if len(transactions) == 0 {
+		return fail(o, "Błąd: brak transakcji w plikach CSV")
+	}
+	o.Printf("✓ Wczytano %d transakcji\n", len(transactions))
+
+	routes, err := routeTransactions(cfg, transactions)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	if len(routes) == 1 {
+		if _, ok := routes[cfg.Profile]; ok {
+			return printTransactions(o, cfg, profilePaths(fs, cfg, paths), transactions, csvPath, *dryRun, *cashier, policy)
+		}
+	}
+
+	exitCode := exitOK
+	for _, name := range cfg.PrinterNames() {
+		if len(routes[name]) == 0 {
+			continue
+		}
+		o.Printf("\n🖨 Drukarka %s: %d transakcji\n", name, len(routes[name]))
+		pcfg, err := useProfile(o, cfg, name)
+		if err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+		if code := printTransactions(o, pcfg, profilePaths(fs, pcfg, paths), routes[name], csvPath, *dryRun, *cashier, policy); code != exitOK {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
+
+// routeTransactions dzieli transakcje między drukarki według kolumny store;
+// transakcje bez niej trafiają do drukarki wybranej w cfg.
+func routeTransactions(cfg *Config, transactions []Transaction) (map[string][]Transaction, error) {
+	routes := make(map[string][]Transaction)
+	for _, t := range transactions {
+		name := t.Store
+		if name == "" {
+			name = cfg.Profile
+		}
+		if _, err := cfg.ForPrinter(name); err != nil {
+			return nil, fmt.Errorf("transakcja %s %s zł: %w", t.Date, formatAmount(t.Amount), err)
+		}
+		routes[name] = append(routes[name], t)
+	}
+	return routes, nil
+}
+
+// printTransactions drukuje transakcje na jednej drukarce, dzień po dniu,
+// z raportami dobowymi według polityki.
+func printTransactions(o *Output, cfg *Config, paths SessionPaths, transactions []Transaction, csvPath string, dryRun bool, cashier, policy string) int {
+	grouped := GroupByDate(transactions)
+	dates := GetUniqueDates(transactions)
+	o.Printf("✓ Znaleziono %d unikalnych dni\n", len(dates))
+
+	// drukarka przed plikiem danych: gdy zajmuje ją inny proces, transakcje
+	// trafiają do jego kolejki bez sięgania po stany magazynowe
+	var fc *FiscalClient
+	var err error
+	if !dryRun {
+		fc, err = connectPrinter(o, cfg)
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			if policy != ReportPolicyNever {
+				o.Warn("raporty dobowe nie są dodawane do kolejki - wydrukuj je poleceniem report daily")
+			}
+			jobs := make([]*Job, len(transactions))
+			for i := range transactions {
+				jobs[i] = &Job{Kind: JobReceipt, Source: "print " + csvPath, Transaction: &transactions[i]}
+			}
+			return enqueueJobs(o, cfg, locked, jobs)
+		}
+		if err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+	} else {
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+	}
+
+	dataConfig, err := loadData(o, paths.Data)
+	if err != nil {
+		if fc != nil {
+			fc.Close()
+		}
+		return fail(o, "Błąd: %v", err)
+	}
+
+	session, err := NewPrintSession(cfg, dataConfig, paths, fc, o)
+	if err != nil {
+		if fc != nil {
+			fc.Close()
+		}
+		return fail(o, "Błąd: %v", err)
+	}
+	session.SetCashier(cashier)
+
+	var worker *Worker
+	if !dryRun {
+		queue, err := OpenJobQueue(cfg.Printer.QueuePath())
+		if err != nil {
+			fc.Close()
+			return fail(o, "Błąd: %v", err)
+		}
+		worker = NewWorker(queue, cfg, session, fc, o)
+		defer worker.ClosePrinter()
+	}
+
+	for i, date := range dates {
+		dayTransactions := grouped[date]
+		session.BeginDay(date, len(dayTransactions))
+		for i, trans := range dayTransactions {
+			session.Process(trans, i+1, len(dayTransactions))
+		}
+		session.EndDay(date)
+
+		if dryRun {
+			o.Printf("\n✓ [SYMULACJA] Raport dobowy (polityka %s, pominięty w trybie testowym)\n", policy)
+			o.Event("report_skipped", ReportEvent{Report: "daily", Date: date, DryRun: true})
+			continue
+		}
+
+		if wantDailyReport(o, policy, i == len(dates)-1) {
+			session.DailyReport("print")
+		} else {
+			o.Println("⊘ Pominięto raport dobowy")
+			o.Event("report_skipped", ReportEvent{Report: "daily", Date: date})
+		}
+	}
+
+	if worker != nil {
+		worker.Start()
+		if n := worker.Drain(); n > 0 {
+			o.Printf("\n✓ Wykonano %d zleceń z kolejki\n", n)
+		}
+	}
+
+	session.Save()
+	session.PrintSummary(len(dates))
+
+	if session.Errors > 0 {
+		o.Printf("\n⚠ Zakończono z błędami\n")
+		return exitFailure
+	}
+
+	o.Printf("\n✓ Zakończono pomyślnie\n")
+	return exitOK
+}
+
+// wantDailyReport rozstrzyga według polityki, czy po dniu wydrukować raport
+// dobowy; w trybie ask pyta użytkownika.
+func wantDailyReport(o *Output, policy string, lastDay bool) bool {
+	switch policy {
+	case ReportPolicyAlways:
+		return true
+	case ReportPolicyNever:
+		return false
+	case ReportPolicyLastDay:
+		return lastDay
+	}
+
+	// w trybie json stdout zawiera tylko zdarzenia, więc pytanie idzie na stderr
+	prompt := os.Stdout
+	if o.JSON() {
+		prompt = os.Stderr
+	}
+	fmt.Fprint(prompt, "\n→ Czy wydrukować raport dobowy? [t/N]: ")
+	var response string
+	fmt.Scanln(&response)
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "t" || response == "tak" || response == "y" || response == "yes"
+}
+
+// stdinIsTerminal zwraca false, gdy wejście jest przekierowane z pliku lub
+// potoku i nie ma kogo zapytać o raport dobowy.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func runReportDaily(args []string) int {
+	fs := newFlagSet("report daily", "")
+	configPath := configFlag(fs)
+	dryRun := dryRunFlag(fs)
+	var fiscalDayPath string
+	fiscalDayFlag(fs, &fiscalDayPath)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *dryRun {
+		if _, err := loadConfig(o, configPath); err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+		o.Println("✓ [SYMULACJA] Raport dobowy")
+		o.Event("report_printed", ReportEvent{Report: "daily", DryRun: true})
+		return exitOK
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	fc, err := connectPrinter(o, cfg)
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		return enqueueJobs(o, cfg, locked, []*Job{{Kind: JobDailyReport, Source: "report daily"}})
+	}
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer fc.Close()
+
+	fiscalDayPath = profileFile(fs, cfg, "fiscal-day", fiscalDayPath)
+	ledger, err := LoadFiscalDay(fiscalDayPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	now := time.Now()
+	rec := ReportRecord{Date: fiscalDate(now), Time: now, Source: "report daily", Status: ReportPrinted}
+
+	o.Println("→ Drukuję raport dobowy...")
+	err = fc.DailyReport("")
+	if err != nil {
+		rec.Status = ReportFailed
+		rec.Error = err.Error()
+	}
+	ledger.AddReport(rec)
+	if serr := ledger.Save(fiscalDayPath); serr != nil {
+		o.Warn("%v", serr)
+	}
+	if err != nil {
+		o.Event("report_failed", ReportEvent{Report: "daily", Error: err.Error()})
+		return fail(o, "❌ BŁĄD RAPORTU DOBOWEGO: %v", err)
+	}
+	o.Println("✓ Raport dobowy wydrukowany")
+	o.Event("report_printed", ReportEvent{Report: "daily"})
+	return exitOK
+}
+
+func runReportMonthly(args []string) int {
+	fs := newFlagSet("report monthly", "")
+	configPath := configFlag(fs)
+	dryRun := dryRunFlag(fs)
+	date := fs.String("date", "", "Data z miesiąca raportu (YYYY-MM-DD, liczy się miesiąc i rok); domyślnie bieżący miesiąc")
+	summary := fs.Bool("summary", false, "Raport w wersji skróconej (podsumowanie)")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+	if *date != "" {
+		if _, err := time.Parse("2006-01-02", *date); err != nil {
+			return usageError(fs, "nieprawidłowa data %q (oczekiwano YYYY-MM-DD)", *date)
+		}
+	}
+
+	if *dryRun {
+		if _, err := loadConfig(o, configPath); err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+		o.Println("✓ [SYMULACJA] Raport miesięczny")
+		o.Event("report_printed", ReportEvent{Report: "monthly", Date: *date, Summary: *summary, DryRun: true})
+		return exitOK
+	}
+
+	_, fc, code := openPrinter(o, configPath)
+	if fc == nil {
+		return code
+	}
+	defer fc.Close()
+
+	reportType := "pełny"
+	if *summary {
+		reportType = "skrócony"
+	}
+	o.Printf("→ Drukuję raport miesięczny (%s)...\n", reportType)
+	if err := fc.MonthlyReport(*date, *summary); err != nil {
+		o.Event("report_failed", ReportEvent{Report: "monthly", Date: *date, Summary: *summary, Error: err.Error()})
+		return fail(o, "❌ BŁĄD RAPORTU MIESIĘCZNEGO: %v", err)
+	}
+	o.Println("✓ Raport miesięczny wydrukowany")
+	o.Event("report_printed", ReportEvent{Report: "monthly", Date: *date, Summary: *summary})
+	return exitOK
+}
+
+func runStatus(args []string) int {
+	fs := newFlagSet("status", "")
+	configPath := configFlag(fs)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	_, fc, code := openPrinter(o, configPath)
+	if fc == nil {
+		return code
+	}
+	defer fc.Close()
+
+	fields, err := fc.Status()
+	if err != nil {
+		return fail(o, "❌ BŁĄD ODCZYTU STANU: %v", err)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	o.Println("📠 STAN DRUKARKI:")
+	for _, k := range keys {
+		o.Printf("  %s: %s\n", k, fields[k])
+	}
+	o.Event("status", fields)
+	return exitOK
+}
+
+func runConfigInit(args []string) int {
+	fs := newFlagSet("config init", "")
+	configPath := fs.String("config", "config.json", "Ścieżka do pliku konfiguracji")
+	dataPath := dataFlag(fs)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg := CreateExampleConfig()
+	if err := cfg.SaveConfig(*configPath); err != nil {
+		return fail(o, "Błąd zapisu przykładowej konfiguracji: %v", err)
+	}
+	o.Printf("✓ Utworzono przykładową konfigurację: %s\n", *configPath)
+
+	data := CreateExampleData()
+	if err := data.SaveData(*dataPath, defaultDataBackups); err != nil {
+		return fail(o, "Błąd zapisu przykładowych danych: %v", err)
+	}
+	o.Printf("✓ Utworzono przykładowe dane produktów: %s\n", *dataPath)
+	o.Println("Edytuj pliki i dostosuj ustawienia przed użyciem.")
+	o.Event("config_created", FilesEvent{Files: []string{*configPath, *dataPath}})
+	return exitOK
+}
+
+func runConfigMigrate(args []string) int {
+	fs := newFlagSet("config migrate", "")
+	configPath := fs.String("config", "config.json", "Ścieżka do pliku konfiguracji")
+	dataPath := dataFlag(fs)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	exitCode := exitOK
+	for _, migrate := range []struct {
+		path string
+		fn   func(string) (*MigrationResult, error)
+	}{
+		{*configPath, MigrateConfigFile},
+		{*dataPath, MigrateDataFile},
+	} {
+		res, err := migrate.fn(migrate.path)
+		if err != nil {
+			exitCode = fail(o, "Błąd: %v", err)
+			continue
+		}
+		if !res.Upgraded() {
+			o.Printf("✓ %s jest w bieżącej wersji %d\n", res.File, res.To)
+			o.Event("file_migrated", res)
+			continue
+		}
+		o.Printf("✓ %s: wersja %d → %d (kopia oryginału: %s)\n", res.File, res.From, res.To, res.Backup)
+		for _, step := range res.Applied {
+			o.Printf("  • %s\n", step)
+		}
+		o.Event("file_migrated", res)
+	}
+	return exitCode
+}
+
+func runConfigShow(args []string) int {
+	fs := newFlagSet("config show", "")
+	configPath := configFlag(fs)
+	effective := fs.Bool("effective", false, "Pokaż konfigurację po złożeniu wartości domyślnych, pliku, zmiennych POSNET_* i flag wraz ze źródłem każdej wartości")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if !*effective {
+		data, err := os.ReadFile(configPath.path)
+		if err != nil {
+			return fail(o, "Błąd odczytu pliku config: %v", err)
+		}
+		if !json.Valid(data) {
+			return fail(o, "Błąd: %s nie zawiera poprawnego JSON", configPath.path)
+		}
+		o.Println(strings.TrimSpace(string(data)))
+		o.Event("config", json.RawMessage(data))
+		return exitOK
+	}
+
+	cfg, err := LoadLayeredConfig(configPath.path, configPath.printer, configPath.overrides)
+	if err != nil {
+		return fail(o, "Błąd wczytywania konfiguracji: %v", err)
+	}
+	values := cfg.Effective()
+	width := 0
+	for _, v := range values {
+		width = max(width, len(v.Path))
+	}
+	o.Printf("⚙ KONFIGURACJA (drukarka %s):\n", cfg.Profile)
+	for _, v := range values {
+		value, _ := json.Marshal(v.Value)
+		o.Printf("  %-*s = %s  [%s]\n", width, v.Path, value, v.Source)
+	}
+	o.Event("config_effective", ConfigEvent{Printer: cfg.Profile, Values: values})
+	return exitOK
+}
+
+func runConfigValidate(args []string) int {
+	fs := newFlagSet("config validate", "")
+	configPath := configFlag(fs)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg, err := LoadLayeredConfig(configPath.path, configPath.printer, configPath.overrides)
+	var invalid *ConfigError
+	if errors.As(err, &invalid) {
+		o.Printf("❌ Konfiguracja %s zawiera błędy (%d):\n", configPath.path, len(invalid.Problems))
+		for _, p := range invalid.Problems {
+			o.Printf("  • %s: %s\n", p.Path, p.Message)
+		}
+		o.Event("config_validated", ConfigCheckEvent{File: configPath.path, Problems: invalid.Problems})
+		return exitFailure
+	}
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	o.Printf("✓ Konfiguracja %s jest poprawna (drukarki: %s)\n", configPath.path, strings.Join(cfg.PrinterNames(), ", "))
+	o.Event("config_validated", ConfigCheckEvent{File: configPath.path, Valid: true})
+	return exitOK
+}
+
+func runStock(args []string) int {
+	fs := newFlagSet("stock", "")
+	configPath := configFlag(fs)
+	dataPath := dataFlag(fs)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	data, err := LoadData(profileData(fs, cfg, *dataPath))
+	if err != nil {
+		return fail(o, "Błąd wczytywania danych: %v", err)
+	}
+	printStock(o, data)
+	o.Event("stock", StockEvent{Products: data.Products})
+	return exitOK
+}
+
+func runJournal(args []string) int {
+	fs := newFlagSet("journal", "<NR|NR..NR|YYYY-MM-DD..YYYY-MM-DD>")
+	configPath := configFlag(fs)
+	format := fs.String("format", "txt", "Format eksportu kopii elektronicznej: txt|json")
+	out := fs.String("out", "journal", "Katalog docelowy eksportu kopii elektronicznej")
+	force := fs.Bool("force", false, "Nadpisz wcześniej wyeksportowane pliki dokumentów")
+	var documentsPath string
+	documentsFlag(fs, &documentsPath)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagany numer dokumentu, zakres numerów lub zakres dat")
+	}
+	if *format != "txt" && *format != "json" {
+		return usageError(fs, "nieznany format eksportu %q", *format)
+	}
+
+	jr, err := ParseJournalRange(fs.Arg(0))
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+
+	cfg, fc, code := openPrinter(o, configPath)
+	if fc == nil {
+		return code
+	}
+	defer fc.Close()
+
+	ledger, err := LoadDocuments(profileFile(fs, cfg, "documents", documentsPath))
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	o.Println("→ Odczytuję kopię elektroniczną...")
+	docs, err := fc.ReadJournal(jr)
+	if err != nil {
+		if len(docs) == 0 {
+			return fail(o, "❌ BŁĄD ODCZYTU KOPII ELEKTRONICZNEJ: %v", err)
+		}
+		fail(o, "❌ BŁĄD ODCZYTU KOPII ELEKTRONICZNEJ: %v", err)
+		o.Warn("eksportuję %d odczytanych dokumentów", len(docs))
+	}
+
+	files, exportErr := ExportJournal(docs, ledger, *out, *format, *force)
+	for _, f := range files {
+		o.Printf("  • %s\n", f)
+	}
+	if exportErr != nil {
+		return fail(o, "❌ BŁĄD EKSPORTU: %v", exportErr)
+	}
+	o.Printf("✓ Wyeksportowano %d dokumentów do %s\n", len(files), *out)
+	o.Event("journal_exported", FilesEvent{Files: files})
+
+	if err != nil {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runForm(args []string) int {
+	fs := newFlagSet("form", "[linia...]")
+	configPath := configFlag(fs)
+	dryRun := dryRunFlag(fs)
+	file := fs.String("file", "", "Plik z treścią wydruku (\"-\" oznacza stdin); linia \"---\" to separator, \"~tekst\" to mała czcionka")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+
+	lines := fs.Args()
+	if *file != "" {
+		if len(lines) > 0 {
+			return usageError(fs, "podaj treść w pliku albo jako argumenty, nie oba naraz")
+		}
+		var err error
+		lines, err = readFormLines(*file)
+		if err != nil {
+			return fail(o, "Błąd odczytu %s: %v", *file, err)
+		}
+	}
+	if len(lines) == 0 {
+		return usageError(fs, "brak treści wydruku")
+	}
+
+	if *dryRun {
+		if _, err := loadConfig(o, configPath); err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+		for _, l := range lines {
+			o.Printf("  | %s\n", l)
+		}
+		o.Println("✓ [SYMULACJA] Wydruk niefiskalny")
+		o.Event("form_printed", ReportEvent{Report: "form", DryRun: true})
+		return exitOK
+	}
+
+	_, fc, code := openPrinter(o, configPath)
+	if fc == nil {
+		return code
+	}
+	defer fc.Close()
+
+	o.Println("→ Drukuję wydruk niefiskalny...")
+	if err := fc.PrintForm(lines); err != nil {
+		return fail(o, "❌ BŁĄD WYDRUKU: %v", err)
+	}
+	o.Println("✓ Wydruk niefiskalny wydrukowany")
+	o.Event("form_printed", ReportEvent{Report: "form"})
+	return exitOK
+}
+
+func readFormLines(path string) ([]string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	return lines, scanner.Err()
+}
+
+func runDrawer(args []string) int {
+	fs := newFlagSet("drawer", "")
+	configPath := configFlag(fs)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	_, fc, code := openPrinter(o, configPath)
+	if fc == nil {
+		return code
+	}
+	defer fc.Close()
+
+	o.Println("→ Otwieram szufladę...")
+	if err := fc.OpenDrawer(); err != nil {
+		return fail(o, "❌ BŁĄD OTWIERANIA SZUFLADY: %v", err)
+	}
+	o.Println("✓ Szuflada otwarta")
+	o.Event("drawer_opened", nil)
+	return exitOK
+}
+
+type cashLabels struct {
+	nominative, accusative, genitive string
+}
+
+func runCashIn(args []string) int {
+	return runCashOperation("cash in", "cashin", cashLabels{"Wpłata", "wpłatę", "wpłaty"}, args)
+}
+
+func runCashOut(args []string) int {
+	return runCashOperation("cash out", "cashout", cashLabels{"Wypłata", "wypłatę", "wypłaty"}, args)
+}
+
+// runCashOperation rejestruje wpłatę lub wypłatę, zapisuje ją w bieżącej
+// zmianie i otwiera szufladę.
+func runCashOperation(name, opType string, label cashLabels, args []string) int {
+	fs := newFlagSet(name, "<kwota>")
+	configPath := configFlag(fs)
+	dryRun := dryRunFlag(fs)
+	shiftPath := fs.String("shift", "shift.json", "Ścieżka do pliku bieżącej zmiany")
+	cashier := fs.String("cashier", "", "Nazwa kasjera zapisywana w bieżącej zmianie")
+	noDrawer := fs.Bool("no-drawer", false, "Nie otwieraj szuflady po operacji")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagana kwota, np. 200,00")
+	}
+	amount, err := parseAmount(fs.Arg(0))
+	if err != nil || amount <= 0 {
+		return usageError(fs, "nieprawidłowa kwota %s: %q", label.genitive, fs.Arg(0))
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	*shiftPath = profileFile(fs, cfg, "shift", *shiftPath)
+	shift, err := LoadShift(*shiftPath)
+	if err != nil {
+		return fail(o, "Błąd wczytywania zmiany: %v", err)
+	}
+	if *cashier != "" {
+		shift.Cashier = *cashier
+	}
+
+	if *dryRun {
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+		o.Printf("✓ [SYMULACJA] %s %s zł\n", label.nominative, formatAmount(amount))
+		o.Event("cash_registered", CashEvent{Type: opType, Amount: amount, DryRun: true})
+		return exitOK
+	}
+
+	fc, err := connectPrinter(o, cfg)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer fc.Close()
+
+	o.Printf("→ Rejestruję %s %s zł...\n", label.accusative, formatAmount(amount))
+	if opType == "cashin" {
+		err = fc.CashIn(amount)
+	} else {
+		err = fc.CashOut(amount)
+	}
+	if err != nil {
+		return fail(o, "❌ BŁĄD %s: %v", strings.ToUpper(label.genitive), err)
+	}
+	shift.AddOperation(opType, amount)
+	o.Printf("✓ %s zarejestrowana\n", label.nominative)
+	o.Event("cash_registered", CashEvent{Type: opType, Amount: amount})
+
+	exitCode := exitOK
+	if !*noDrawer {
+		o.Println("→ Otwieram szufladę...")
+		if err := fc.OpenDrawer(); err != nil {
+			exitCode = fail(o, "❌ BŁĄD OTWIERANIA SZUFLADY: %v", err)
+		} else {
+			o.Println("✓ Szuflada otwarta")
+			o.Event("drawer_opened", nil)
+		}
+	}
+
+	if err := shift.Save(*shiftPath); err != nil {
+		exitCode = fail(o, "⚠ OSTRZEŻENIE: nie udało się zapisać zmiany: %v", err)
+	}
+	return exitCode
+}
+
+func runShiftReport(args []string) int {
+	fs := newFlagSet("shift report", "")
+	configPath := configFlag(fs)
+	dryRun := dryRunFlag(fs)
+	shiftPath := fs.String("shift", "shift.json", "Ścieżka do pliku bieżącej zmiany")
+	cashier := fs.String("cashier", "", "Nazwa kasjera zapisywana w bieżącej zmianie")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	*shiftPath = profileFile(fs, cfg, "shift", *shiftPath)
+	shift, err := LoadShift(*shiftPath)
+	if err != nil {
+		return fail(o, "Błąd wczytywania zmiany: %v", err)
+	}
+	if *cashier != "" {
+		shift.Cashier = *cashier
+	}
+
+	if *dryRun {
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+		o.Println("✓ [SYMULACJA] Raport zmiany")
+		o.Event("report_printed", ReportEvent{Report: "shift", DryRun: true})
+		return exitOK
+	}
+
+	fc, err := connectPrinter(o, cfg)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer fc.Close()
+
+	o.Println("→ Drukuję raport zmiany...")
+	if err := fc.ShiftReport(shift, time.Now()); err != nil {
+		o.Event("report_failed", ReportEvent{Report: "shift", Error: err.Error()})
+		return fail(o, "❌ BŁĄD RAPORTU ZMIANY: %v", err)
+	}
+	o.Println("✓ Raport zmiany wydrukowany")
+	o.Event("report_printed", ReportEvent{Report: "shift"})
+
+	shift = &ShiftLedger{Cashier: shift.Cashier, Start: time.Now()}
+	if err := shift.Save(*shiftPath); err != nil {
+		return fail(o, "⚠ OSTRZEŻENIE: nie udało się zapisać zmiany: %v", err)
+	}
+	return exitOK
+}
+
+func runVoucherIssue(args []string) int {
+	fs := newFlagSet("voucher issue", "<KOD:WARTOŚĆ[:YYYY-MM-DD]>")
+	configPath := configFlag(fs)
+	vouchersPath := fs.String("vouchers", "vouchers.json", "Ścieżka do rejestru bonów i kart podarunkowych")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagana specyfikacja bonu KOD:WARTOŚĆ[:YYYY-MM-DD]")
+	}
+
+	voucherCode, value, expiry, err := ParseVoucherSpec(fs.Arg(0))
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	*vouchersPath = profileFile(fs, cfg, "vouchers", *vouchersPath)
+	_, err = UpdateVouchers(*vouchersPath, func(r *VoucherRegistry) error {
+		return r.Issue(voucherCode, value, expiry)
+	})
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	o.Printf("✓ Dodano bon %s na kwotę %s zł\n", voucherCode, formatAmount(value))
+	o.Event("voucher_issued", Voucher{Code: voucherCode, FaceValue: value, Balance: value, Expiry: expiry})
+	return exitOK
+}
+
+func runCaptureShow(args []string) int {
+	fs := newFlagSet("capture show", "<nagranie.jsonl>")
+	encoding := fs.String("encoding", "cp1250", "Kodowanie tekstu w ramkach")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagana ścieżka do pliku nagrania")
+	}
+	enc, err := parseEncoding(*encoding)
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+
+	records, err := ReadCapture(fs.Arg(0))
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	var start time.Time
+	for _, rec := range records {
+		if rec.Dir == CaptureOpen {
+			start = rec.Time
+			o.Printf("\n⏺ %s połączenie z %s\n", rec.Time.Format("2006-01-02 15:04:05.000"), rec.Addr)
+			o.Event("capture_open", rec)
+			continue
+		}
+		payload, _ := rec.Bytes()
+		ev := FrameEvent{Time: rec.Time, Dir: rec.Dir, Frame: DescribeFrame(enc, payload), Invalid: rec.Invalid}
+		arrow := "→"
+		if rec.Dir == CaptureRX {
+			arrow = "←"
+		}
+		frame := ev.Frame
+		if ev.Invalid != "" {
+			frame = fmt.Sprintf("✗ %s (odrzucona: %s)", frame, ev.Invalid)
+		}
+		o.Printf("%+9.3fs %s %s\n", rec.Time.Sub(start).Seconds(), arrow, frame)
+		o.Event("capture_frame", ev)
+	}
+	return exitOK
+}
+
+func runReplay(args []string) int {
+	fs := newFlagSet("replay", "<nagranie.jsonl>")
+	listen := fs.String("listen", "127.0.0.1:6666", "Adres, na którym nasłuchuje emulator drukarki")
+	encoding := fs.String("encoding", "cp1250", "Kodowanie tekstu w ramkach")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagana ścieżka do pliku nagrania")
+	}
+	enc, err := parseEncoding(*encoding)
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+
+	records, err := ReadCapture(fs.Arg(0))
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	emu := NewEmulator(records, enc, o)
+	if emu.Done() {
+		return fail(o, "Błąd: nagranie nie zawiera ramek")
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer ln.Close()
+
+	o.Printf("→ Emulator drukarki nasłuchuje na %s\n", ln.Addr())
+	o.Println("  Uruchom program z host/port w config.json wskazującymi na ten adres.")
+	o.Event("replay_listening", MessageEvent{Message: ln.Addr().String()})
+
+	for !emu.Done() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+		o.Printf("\n⏺ Połączenie z %s\n", conn.RemoteAddr())
+		if err := emu.Serve(conn); err != nil {
+			o.Warn("połączenie przerwane: %v", err)
+		}
+	}
+
+	o.Printf("\n✓ Odtworzono %d ramek, rozbieżności: %d\n", emu.Frames, emu.Mismatches)
+	o.Event("replay_finished", ReplayEvent{Frames: emu.Frames, Mismatches: emu.Mismatches})
+	if emu.Mismatches > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runServe(args []string) int {
+	fs := newFlagSet("serve", "")
+	configPath := configFlag(fs)
+	dataPath := dataFlag(fs)
+	dryRun := dryRunFlag(fs)
+	listen := fs.String("listen", "127.0.0.1:8080", "Adres, na którym nasłuchuje API HTTP")
+	cashier := fs.String("cashier", "", "Nazwa kasjera zapisywana w bieżącej zmianie")
+	paths := DefaultSessionPaths()
+	ledgerFlags(fs, &paths)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+	paths.Data = *dataPath
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	paths = profilePaths(fs, cfg, paths)
+	queue, worker, err := openWorker(o, cfg, paths, *dryRun)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer worker.ClosePrinter()
+	worker.session.SetCashier(*cashier)
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	o.Printf("→ API nasłuchuje na http://%s (Ctrl+C kończy)\n", ln.Addr())
+	o.Event("serve_listening", MessageEvent{Message: ln.Addr().String()})
+
+	server := NewServer(queue, worker, o)
+	if err := server.Serve(ctx, ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fail(o, "Błąd serwera: %v", err)
+	}
+
+	o.Printf("\n✓ Serwer zatrzymany\n")
+	o.Event("serve_stopped", nil)
+	return exitOK
+}
+
+// openWorker łączy się z drukarką (z blokadą) i przygotowuje worker kolejki
+// zleceń. W trybie testowym używa osobnej kolejki, aby symulacja nie
+// wykonała zleceń przeznaczonych dla drukarki.
+func openWorker(o *Output, cfg *Config, paths SessionPaths, dryRun bool) (*JobQueue, *Worker, error) {
+	dataConfig, err := loadData(o, paths.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := cfg.Printer.QueuePath()
+	var fc *FiscalClient
+	if dryRun {
+		o.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
+		dir = filepath.Join(dir, "dry-run")
+	} else if fc, err = connectPrinter(o, cfg); err != nil {
+		return nil, nil, err
+	}
+
+	queue, err := OpenJobQueue(dir)
+	if err == nil {
+		var session *PrintSession
+		if session, err = NewPrintSession(cfg, dataConfig, paths, fc, o); err == nil {
+			worker := NewWorker(queue, cfg, session, fc, o)
+			if cfg.Scheduler.Enabled() && !dryRun {
+				worker.SetScheduler(NewScheduler(cfg.Scheduler, queue, session.FiscalDay(), o))
+			}
+			worker.Start()
+			return queue, worker, nil
+		}
+	}
+	if fc != nil {
+		fc.Close()
+	}
+	return nil, nil, err
+}
+
+// enqueueJobs dodaje zlecenia do kolejki, gdy drukarkę obsługuje inny
+// proces; wykona je ten proces albo kolejne uruchomienie z blokadą.
+func enqueueJobs(o *Output, cfg *Config, locked *LockedError, jobs []*Job) int {
+	queue, err := OpenJobQueue(cfg.Printer.QueuePath())
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	for _, job := range jobs {
+		if err := queue.Add(job); err != nil {
+			return fail(o, "Błąd: %v", err)
+		}
+		o.Event("job_queued", job)
+	}
+	o.Printf("⏳ %v\n", locked)
+	o.Printf("✓ Dodano zleceń do kolejki: %d (wykona je proces obsługujący drukarkę)\n", len(jobs))
+	return exitOK
+}
+
+func runQueueList(args []string) int {
+	fs := newFlagSet("queue list", "")
+	configPath := configFlag(fs)
+	all := fs.Bool("all", false, "Pokaż również zakończone zlecenia")
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	queue, err := OpenJobQueue(cfg.Printer.QueuePath())
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	jobs, err := queue.List()
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	o.Println("📋 KOLEJKA ZLECEŃ:")
+	shown := 0
+	for _, job := range jobs {
+		if !*all && (job.State == JobDone || job.State == JobFailed) {
+			continue
+		}
+		shown++
+		line := fmt.Sprintf("  %-9s %s  %s", job.State, job.ID, job.Kind)
+		if job.Transaction != nil {
+			line += fmt.Sprintf(" %s %s", job.Transaction.Date, formatAmount(job.Transaction.Amount))
+		}
+		if job.Error != "" {
+			line += "  " + job.Error
+		}
+		o.Println(line)
+		o.Event("job", job)
+	}
+	if shown == 0 {
+		o.Println("  (brak zleceń)")
+	}
+	return exitOK
+}
+
+func runQueueRun(args []string) int {
+	fs := newFlagSet("queue run", "")
+	configPath := configFlag(fs)
+	dataPath := dataFlag(fs)
+	paths := DefaultSessionPaths()
+	ledgerFlags(fs, &paths)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+	paths.Data = *dataPath
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	paths = profilePaths(fs, cfg, paths)
+	_, worker, err := openWorker(o, cfg, paths, false)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer worker.ClosePrinter()
+
+	n := worker.Drain()
+	o.Printf("\n✓ Wykonano zleceń z kolejki: %d\n", n)
+	if worker.session.Errors > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runWatch(args []string) int {
+	fs := newFlagSet("watch", "<katalog>")
+	configPath := configFlag(fs)
+	dataPath := dataFlag(fs)
+	dryRun := dryRunFlag(fs)
+	cashier := fs.String("cashier", "", "Nazwa kasjera zapisywana w bieżącej zmianie")
+	pattern := fs.String("pattern", "*.csv", "Wzorzec nazw przetwarzanych plików")
+	interval := fs.Duration("interval", 10*time.Second, "Odstęp między przeglądami katalogu")
+	once := fs.Bool("once", false, "Przetwórz pliki obecne w katalogu i zakończ")
+	paths := DefaultSessionPaths()
+	ledgerFlags(fs, &paths)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		return usageError(fs, "wymagana ścieżka do obserwowanego katalogu")
+	}
+	if *interval <= 0 {
+		return usageError(fs, "odstęp -interval musi być dodatni")
+	}
+	dir := fs.Arg(0)
+	paths.Data = *dataPath
+
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return fail(o, "Błąd: %s nie jest katalogiem", dir)
+	}
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	paths = profilePaths(fs, cfg, paths)
+	_, worker, err := openWorker(o, cfg, paths, *dryRun)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer worker.ClosePrinter()
+	worker.session.SetCashier(*cashier)
+
+	watcher, err := NewWatcher(dir, *pattern, worker, o)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+
+	if *once || *dryRun {
+		failed := watcher.Scan(true)
+		if !*dryRun {
+			worker.Drain()
+		}
+		if failed > 0 {
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	o.Printf("→ Obserwuję katalog %s (%s, co %s; Ctrl+C kończy)\n", dir, *pattern, *interval)
+	o.Event("watch_started", MessageEvent{Message: dir})
+	watcher.Run(ctx, *interval)
+
+	o.Printf("\n✓ Obserwacja zakończona\n")
+	o.Event("watch_stopped", nil)
+	return exitOK
+}
+
+func runDaemon(args []string) int {
+	fs := newFlagSet("daemon", "")
+	configPath := configFlag(fs)
+	dataPath := dataFlag(fs)
+	paths := DefaultSessionPaths()
+	ledgerFlags(fs, &paths)
+	o, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "nieoczekiwane argumenty: %s", strings.Join(fs.Args(), " "))
+	}
+	paths.Data = *dataPath
+
+	cfg, err := loadConfig(o, configPath)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	paths = profilePaths(fs, cfg, paths)
+	if !cfg.Scheduler.Enabled() {
+		o.Warn("brak scheduler.daily_report_at w konfiguracji - wykonywana będzie tylko kolejka zleceń")
+	}
+	_, worker, err := openWorker(o, cfg, paths, false)
+	if err != nil {
+		return fail(o, "Błąd: %v", err)
+	}
+	defer worker.ClosePrinter()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Scheduler.Enabled() {
+		o.Printf("→ Raport dobowy codziennie o %s (Ctrl+C kończy)\n", cfg.Scheduler.DailyReportAt)
+	}
+	o.Event("daemon_started", nil)
+	worker.Run(ctx)
+
+	o.Printf("\n✓ Demon zatrzymany\n")
+	o.Event("daemon_stopped", nil)
+	return exitOK
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 )
 
 type Product struct {
@@ -15,62 +19,344 @@ type Product struct {
 }
 
 type PrinterConfig struct {
-	Host    string `json:"host"`
-	Port    int    `json:"port"`
-	Timeout int    `json:"timeout"`
-	LogTX   bool   `json:"log_tx"`
-	LogRX   bool   `json:"log_rx"`
+	Host            string `json:"host"`
+	Port            int    `json:"port"`
+	Timeout         int    `json:"timeout"`
+	LogTX           bool   `json:"log_tx"`
+	LogRX           bool   `json:"log_rx"`
+	CustomerDisplay bool   `json:"customer_display"`
+	Capture         string `json:"capture,omitempty"`
+	QueueDir        string `json:"queue_dir,omitempty"`
+}
+
+const defaultQueueDir = "queue"
+
+// QueuePath zwraca katalog kolejki zleceń i blokady drukarki.
+func (p PrinterConfig) QueuePath() string {
+	if p.QueueDir == "" {
+		return defaultQueueDir
+	}
+	return p.QueueDir
+}
+
+// DefaultPrinter to nazwa drukarki z sekcji printer; pozostałe drukarki są
+// profilami z sekcji printers.
+const DefaultPrinter = "default"
+
+// PrinterProfile to nazwana drukarka, np. kasa w innym sklepie. Pola encoding
+// i fiscal (cała sekcja) zastępują ustawienia globalne, a brakujący timeout
+// jest brany z sekcji printer. Data wskazuje osobny plik produktów, a dir
+// katalog rejestrów i kolejki profilu (domyślnie nazwa profilu).
+type PrinterProfile struct {
+	PrinterConfig
+	Encoding string        `json:"encoding,omitempty"`
+	Fiscal   *FiscalConfig `json:"fiscal,omitempty"`
+	Data     string        `json:"data,omitempty"`
+	Dir      string        `json:"dir,omitempty"`
 }
 
 type FiscalConfig struct {
-	VATRate        int `json:"vat_rate"`
-	PaymentType    int `json:"payment_type"`
-	ShippingChance int `json:"shipping_chance"`
-	ShippingPrice  int `json:"shipping_price"`
+	VATRate            int      `json:"vat_rate"`
+	PaymentType        int      `json:"payment_type"`
+	VoucherPaymentType int      `json:"voucher_payment_type"`
+	ShippingChance     int      `json:"shipping_chance"`
+	ShippingPrice      int      `json:"shipping_price"`
+	FooterLines        []string `json:"footer_lines,omitempty"`
+	VATRates           []string `json:"vat_rates,omitempty"`
+}
+
+func (f FiscalConfig) VATTable() (VATTable, error) {
+	return ParseVATTable(f.VATRates)
+}
+
+const defaultVoucherPaymentType = 4
+
+const defaultDataBackups = 5
+
+func (f FiscalConfig) VoucherType() int {
+	if f.VoucherPaymentType == 0 {
+		return defaultVoucherPaymentType
+	}
+	return f.VoucherPaymentType
+}
+
+type EReceiptConfig struct {
+	Mode    string `json:"mode"`
+	Outbox  string `json:"outbox"`
+	SignKey string `json:"sign_key"`
+}
+
+func (e EReceiptConfig) Enabled() bool {
+	return e.Mode == EReceiptBoth || e.Mode == EReceiptElectronic
+}
+
+// Polityki drukowania raportu dobowego po każdym dniu z pliku CSV.
+const (
+	ReportPolicyAsk     = "ask"
+	ReportPolicyAlways  = "always"
+	ReportPolicyNever   = "never"
+	ReportPolicyLastDay = "last-day-only"
+)
+
+func validReportPolicy(p string) bool {
+	switch p {
+	case ReportPolicyAsk, ReportPolicyAlways, ReportPolicyNever, ReportPolicyLastDay:
+		return true
+	}
+	return false
 }
 
 type Config struct {
-	Printer  PrinterConfig `json:"printer"`
-	Fiscal   FiscalConfig  `json:"fiscal"`
-	Encoding string        `json:"encoding"`
+	Version           int                       `json:"version"`
+	Printer           PrinterConfig             `json:"printer"`
+	Printers          map[string]PrinterProfile `json:"printers,omitempty"`
+	Fiscal            FiscalConfig              `json:"fiscal"`
+	EReceipt          EReceiptConfig            `json:"ereceipt"`
+	Encoding          string                    `json:"encoding"`
+	DailyReportPolicy string                    `json:"daily_report_policy,omitempty"`
+	Scheduler         SchedulerConfig           `json:"scheduler"`
+	DataBackups       int                       `json:"data_backups,omitempty"`
+	Log               LogConfig                 `json:"log"`
+
+	// Profile to nazwa wybranej drukarki, DataPath i StateDir to plik
+	// produktów i katalog rejestrów z jej profilu (puste dla DefaultPrinter).
+	Profile  string `json:"-"`
+	DataPath string `json:"-"`
+	StateDir string `json:"-"`
+
+	root     *Config
+	sources  map[string]string
+	migrated *MigrationResult
 }
 
+// LoadConfig wczytuje konfigurację z pliku path z wartościami domyślnymi
+// i zmiennymi środowiskowymi POSNET_* (zob. LoadLayeredConfig).
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("błąd odczytu pliku config: %w", err)
+	return LoadLayeredConfig(path, "", nil)
+}
+
+// PrinterNames zwraca nazwy wszystkich drukarek, zaczynając od
+// DefaultPrinter.
+func (c *Config) PrinterNames() []string {
+	names := make([]string, 0, len(c.Printers))
+	for name := range c.Printers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return append([]string{DefaultPrinter}, names...)
+}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("błąd parsowania JSON: %w", err)
+// ForPrinter zwraca konfigurację z ustawieniami drukarki name; pusta nazwa
+// oznacza DefaultPrinter. Wywołana na konfiguracji profilu wybiera drukarkę
+// spośród wszystkich z pliku.
+func (c *Config) ForPrinter(name string) (*Config, error) {
+	if c.root != nil {
+		return c.root.ForPrinter(name)
+	}
+	cp := *c
+	cp.root = c
+	if name == "" || name == DefaultPrinter {
+		cp.Profile = DefaultPrinter
+		return &cp, nil
+	}
+	p, ok := c.Printers[name]
+	if !ok {
+		return nil, fmt.Errorf("nieznana drukarka %q (dostępne: %s)", name, strings.Join(c.PrinterNames(), ", "))
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+	cp.Profile = name
+	cp.Printer = p.PrinterConfig
+	if cp.Printer.Timeout == 0 {
+		cp.Printer.Timeout = c.Printer.Timeout
+	}
+	if p.Encoding != "" {
+		cp.Encoding = p.Encoding
+	}
+	if p.Fiscal != nil {
+		cp.Fiscal = *p.Fiscal
+	}
+	cp.markProfileSources(name, p, c)
+	cp.DataPath = p.Data
+	cp.StateDir = p.Dir
+	if cp.StateDir == "" {
+		cp.StateDir = name
+	}
+	if cp.Printer.QueueDir == "" {
+		cp.Printer.QueueDir = filepath.Join(cp.StateDir, defaultQueueDir)
+	}
+	return &cp, nil
+}
+
+// DataBackupCount zwraca liczbę zachowywanych kopii pliku danych produktów.
+func (c *Config) DataBackupCount() int {
+	if c.DataBackups == 0 {
+		return defaultDataBackups
+	}
+	return c.DataBackups
+}
+
+// CheckStore odrzuca transakcję, której kolumna store wskazuje inną
+// drukarkę niż wybrana.
+func (c *Config) CheckStore(store string) error {
+	profile := c.Profile
+	if profile == "" {
+		profile = DefaultPrinter
+	}
+	if store == "" || store == profile {
+		return nil
+	}
+	return fmt.Errorf("transakcja dla drukarki %s, a wybrana drukarka to %s", store, profile)
+}
+
+// ConfigProblem to pojedynczy błąd konfiguracji ze ścieżką JSON pola.
+type ConfigProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ConfigError zbiera wszystkie błędy znalezione w konfiguracji.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.Path + ": " + p.Message
+	}
+	if len(lines) == 1 {
+		return lines[0]
+	}
+	return fmt.Sprintf("błędy konfiguracji (%d):\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
+
+// add dopisuje błąd pola path; powtórzenia (np. wspólnej sekcji fiscal
+// sprawdzanej dla kilku drukarek) są pomijane.
+func (e *ConfigError) add(path, format string, args ...interface{}) {
+	p := ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)}
+	for _, prev := range e.Problems {
+		if prev == p {
+			return
+		}
 	}
+	e.Problems = append(e.Problems, p)
+}
 
-	return &cfg, nil
+// err zwraca e albo nil, gdy nie znaleziono błędów.
+func (e *ConfigError) err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
 }
 
+// Validate sprawdza wszystkie pola konfiguracji i zwraca *ConfigError ze
+// wszystkimi znalezionymi błędami.
 func (c *Config) Validate() error {
+	e := &ConfigError{}
+	if c.Version != ConfigVersion {
+		e.add("version", "nieobsługiwana wersja konfiguracji %d (obecna: %d)", c.Version, ConfigVersion)
+	}
+	c.validatePrinter(e)
+	switch c.EReceipt.Mode {
+	case "", EReceiptPaper:
+	case EReceiptBoth, EReceiptElectronic:
+		if c.EReceipt.Outbox == "" {
+			e.add("ereceipt.outbox", "brak katalogu outbox dla e-paragonów")
+		}
+		if c.EReceipt.SignKey == "" {
+			e.add("ereceipt.sign_key", "brak klucza podpisu e-paragonów")
+		}
+	default:
+		e.add("ereceipt.mode", "nieprawidłowy tryb e-paragonu: %q (dozwolone: paper|both|electronic)", c.EReceipt.Mode)
+	}
+	if c.DailyReportPolicy != "" && !validReportPolicy(c.DailyReportPolicy) {
+		e.add("daily_report_policy", "nieprawidłowa polityka raportu dobowego: %q (dozwolone: ask|always|never|last-day-only)", c.DailyReportPolicy)
+	}
+	if c.DataBackups < 0 {
+		e.add("data_backups", "liczba kopii pliku danych nie może być ujemna: %d", c.DataBackups)
+	}
+	c.Scheduler.validate(e)
+	c.Log.validate(e)
+	if _, ok := c.Printers[DefaultPrinter]; ok {
+		e.add("printers."+DefaultPrinter, "nazwa %q jest zarezerwowana dla drukarki z sekcji printer", DefaultPrinter)
+	}
+	for _, name := range c.PrinterNames() {
+		if name == c.Profile {
+			continue
+		}
+		if name != DefaultPrinter && (name == "" || strings.ContainsAny(name, `/\:`)) {
+			e.add("printers."+name, "nieprawidłowa nazwa drukarki %q", name)
+			continue
+		}
+		if pc, err := c.ForPrinter(name); err == nil {
+			pc.validatePrinter(e)
+		}
+	}
+	return e.err()
+}
+
+// validatePrinter sprawdza ustawienia, które mogą pochodzić z profilu
+// drukarki; ścieżki błędów wskazują sekcję, z której pochodzi wartość.
+func (c *Config) validatePrinter(e *ConfigError) {
+	printerPath, fiscalPath, encodingPath := "printer.", "fiscal.", "encoding"
+	timeoutPath := printerPath + "timeout"
+	if p, ok := c.Printers[c.Profile]; ok && c.Profile != DefaultPrinter {
+		printerPath = "printers." + c.Profile + "."
+		if p.Timeout != 0 {
+			timeoutPath = printerPath + "timeout"
+		}
+		if p.Fiscal != nil {
+			fiscalPath = printerPath + "fiscal."
+		}
+		if p.Encoding != "" {
+			encodingPath = printerPath + "encoding"
+		}
+	}
+
 	if c.Printer.Host == "" {
-		return fmt.Errorf("brak adresu IP drukarki")
+		e.add(printerPath+"host", "brak adresu IP drukarki")
 	}
 	if c.Printer.Port <= 0 || c.Printer.Port > 65535 {
-		return fmt.Errorf("nieprawidłowy port drukarki: %d", c.Printer.Port)
+		e.add(printerPath+"port", "nieprawidłowy port drukarki: %d (dozwolone 1-65535)", c.Printer.Port)
+	}
+	if c.Printer.Timeout <= 0 {
+		e.add(timeoutPath, "timeout połączenia musi być dodatni: %d", c.Printer.Timeout)
+	}
+	if _, err := parseEncoding(c.Encoding); err != nil {
+		e.add(encodingPath, "nieznane kodowanie %q (dozwolone: cp1250|latin2|mazovia|ascii)", c.Encoding)
+	}
+	c.Fiscal.validate(e, fiscalPath)
+}
+
+func (f FiscalConfig) validate(e *ConfigError, prefix string) {
+	vatTable, err := f.VATTable()
+	if err != nil {
+		e.add(prefix+"vat_rates", "%v", err)
 	}
-	if c.Fiscal.VATRate < 0 || c.Fiscal.VATRate > 6 {
-		return fmt.Errorf("nieprawidłowa stawka VAT: %d (dozwolone 0-6)", c.Fiscal.VATRate)
+	if f.VATRate < 0 || f.VATRate > 6 {
+		e.add(prefix+"vat_rate", "nieprawidłowa stawka VAT: %d (dozwolone 0-6)", f.VATRate)
+	} else if _, ok := vatTable[f.VATRate]; !ok && err == nil {
+		e.add(prefix+"vat_rate", "stawka VAT %s jest nieaktywna w vat_rates", vatLetter(f.VATRate))
 	}
 	validPaymentTypes := map[int]bool{0: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true}
-	if !validPaymentTypes[c.Fiscal.PaymentType] {
-		return fmt.Errorf("nieprawidłowy typ płatności: %d", c.Fiscal.PaymentType)
+	if !validPaymentTypes[f.PaymentType] {
+		e.add(prefix+"payment_type", "nieprawidłowy typ płatności: %d", f.PaymentType)
 	}
-	if c.Fiscal.ShippingChance < 0 || c.Fiscal.ShippingChance > 100 {
-		return fmt.Errorf("szansa na wysyłkę poza zakresem 0-100%%: %d", c.Fiscal.ShippingChance)
+	if !validPaymentTypes[f.VoucherPaymentType] {
+		e.add(prefix+"voucher_payment_type", "nieprawidłowy typ płatności bonem: %d", f.VoucherPaymentType)
+	}
+	if f.ShippingChance < 0 || f.ShippingChance > 100 {
+		e.add(prefix+"shipping_chance", "szansa na wysyłkę poza zakresem 0-100%%: %d", f.ShippingChance)
+	}
+	if f.ShippingPrice < 0 || (f.ShippingPrice == 0 && f.ShippingChance > 0) {
+		e.add(prefix+"shipping_price", "cena wysyłki musi być dodatnia (w groszach), gdy shipping_chance > 0: %d", f.ShippingPrice)
+	}
+	for i, line := range f.FooterLines {
+		if strings.ContainsAny(line, "\t\r\n") {
+			e.add(fmt.Sprintf("%sfooter_lines[%d]", prefix, i), "linia stopki nie może zawierać tabulatora ani końca linii")
+		}
 	}
-	return nil
 }
 
 func (c *Config) SaveConfig(path string) error {
@@ -79,7 +365,7 @@ func (c *Config) SaveConfig(path string) error {
 		return fmt.Errorf("błąd serializacji JSON: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := writeFileAtomic(path, data, 0); err != nil {
 		return fmt.Errorf("błąd zapisu pliku config: %w", err)
 	}
 
@@ -88,34 +374,62 @@ func (c *Config) SaveConfig(path string) error {
 
 func CreateExampleConfig() *Config {
 	return &Config{
+		Version: ConfigVersion,
 		Printer: PrinterConfig{
-			Host:    "192.168.69.45",
-			Port:    12345,
-			Timeout: 5,
-			LogTX:   false,
-			LogRX:   true,
+			Host:            "192.168.69.45",
+			Port:            12345,
+			Timeout:         5,
+			LogTX:           false,
+			LogRX:           true,
+			CustomerDisplay: false,
 		},
 		Fiscal: FiscalConfig{
-			VATRate:        0,
-			PaymentType:    8,
-			ShippingChance: 25,
-			ShippingPrice:  1999,
+			VATRate:            0,
+			PaymentType:        8,
+			VoucherPaymentType: defaultVoucherPaymentType,
+			ShippingChance:     25,
+			ShippingPrice:      1999,
+			VATRates:           slices.Clone(defaultVATRates),
+		},
+		EReceipt: EReceiptConfig{
+			Mode:   EReceiptPaper,
+			Outbox: "outbox",
+		},
+		Encoding:          "cp1250",
+		DailyReportPolicy: ReportPolicyAsk,
+		Scheduler: SchedulerConfig{
+			RetryInterval: defaultReportRetryInterval,
+			MaxAttempts:   defaultReportMaxAttempts,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+			Output: LogOutputStderr,
 		},
-		Encoding: "cp1250",
 	}
 }
 
 type DataConfig struct {
+	Version  int       `json:"version"`
 	Products []Product `json:"products"`
+
+	// migrated opisuje podniesienie wersji pliku przy wczytaniu.
+	migrated *MigrationResult
 }
 
+// LoadData wczytuje dane produktów; plik w starszej wersji jest podnoszony
+// w pamięci (zob. upgradeJSON).
 func LoadData(path string) (*DataConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("błąd odczytu pliku data: %w", err)
 	}
+	data, _, res, err := upgradeJSON(path, data, dataMigrations, DataVersion)
+	if err != nil {
+		return nil, err
+	}
 
-	var dataConfig DataConfig
+	dataConfig := DataConfig{migrated: res}
 	if err := json.Unmarshal(data, &dataConfig); err != nil {
 		return nil, fmt.Errorf("błąd parsowania JSON data: %w", err)
 	}
@@ -123,13 +437,15 @@ func LoadData(path string) (*DataConfig, error) {
 	return &dataConfig, nil
 }
 
-func (d *DataConfig) SaveData(path string) error {
+// SaveData zapisuje dane produktów atomowo, zachowując backups poprzednich
+// wersji pliku (zob. writeFileAtomic).
+func (d *DataConfig) SaveData(path string, backups int) error {
 	data, err := json.MarshalIndent(d, "", "  ")
 	if err != nil {
 		return fmt.Errorf("błąd serializacji JSON data: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := writeFileAtomic(path, data, backups); err != nil {
 		return fmt.Errorf("błąd zapisu pliku data: %w", err)
 	}
 
@@ -146,6 +462,15 @@ func (d *DataConfig) GetAvailableProducts() []Product {
 	return available
 }
 
+func (d *DataConfig) HasProduct(productName string) bool {
+	for _, p := range d.Products {
+		if p.Name == productName {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *DataConfig) DecrementStock(productName string) error {
 	for i := range d.Products {
 		if d.Products[i].Name == productName {
@@ -160,8 +485,22 @@ func (d *DataConfig) DecrementStock(productName string) error {
 	return fmt.Errorf("produkt %s: nie znaleziono", productName)
 }
 
+func (d *DataConfig) RestoreStock(productName string) error {
+	for i := range d.Products {
+		if d.Products[i].Name == productName {
+			d.Products[i].Stock++
+			if d.Products[i].Used > 0 {
+				d.Products[i].Used--
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("produkt %s: nie znaleziono", productName)
+}
+
 func CreateExampleData() *DataConfig {
 	return &DataConfig{
+		Version: DataVersion,
 		Products: []Product{
 			{Name: "Spodnie", MinPrice: 50, MaxPrice: 90, Stock: 100},
 			{Name: "Sukienka", MinPrice: 90, MaxPrice: 150, Stock: 80},
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeTestConfig zapisuje config.json o podanej treści w katalogu testu.
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigKeepsDefaultVATRates(t *testing.T) {
+	want := slices.Clone(defaultVATRates)
+	path := writeTestConfig(t, fmt.Sprintf(`{"version": %d, "printer": {"host": "10.0.0.1"}, "fiscal": {"vat_rates": ["8", "23"]}}`, ConfigVersion))
+
+	cfg, err := LoadLayeredConfig(path, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Fiscal.VATRates; !slices.Equal(got, []string{"8", "23"}) {
+		t.Errorf("stawki z pliku = %v, oczekiwano [8 23]", got)
+	}
+	if !slices.Equal(defaultVATRates, want) {
+		t.Errorf("domyślne stawki zmienione na %v, oczekiwano %v", defaultVATRates, want)
+	}
+	if got := CreateExampleConfig().Fiscal.VATRates; !slices.Equal(got, want) {
+		t.Errorf("stawki przykładowej konfiguracji = %v, oczekiwano %v", got, want)
+	}
+}
+
+// problemPaths zwraca ścieżki pól z błędu *ConfigError.
+func problemPaths(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("błąd %v nie jest *ConfigError", err)
+	}
+	var paths []string
+	for _, p := range cfgErr.Problems {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{name: "przykładowa konfiguracja", change: func(c *Config) {}},
+		{
+			name:   "wszystkie błędy naraz",
+			change: func(c *Config) { c.Version = 1; c.Printer.Port = 0; c.Printer.Timeout = 0; c.DataBackups = -1 },
+			want:   []string{"version", "printer.port", "printer.timeout", "data_backups"},
+		},
+		{
+			name:   "e-paragon bez klucza",
+			change: func(c *Config) { c.EReceipt.Mode = EReceiptBoth },
+			want:   []string{"ereceipt.sign_key"},
+		},
+		{
+			name:   "nieaktywna stawka VAT",
+			change: func(c *Config) { c.Fiscal.VATRates = []string{"23"}; c.Fiscal.VATRate = 1 },
+			want:   []string{"fiscal.vat_rate"},
+		},
+		{
+			name:   "stopka z tabulatorem",
+			change: func(c *Config) { c.Fiscal.FooterLines = []string{"ok", "a\tb"} },
+			want:   []string{"fiscal.footer_lines[1]"},
+		},
+		{
+			name: "błąd w profilu drukarki",
+			change: func(c *Config) {
+				c.Printers = map[string]PrinterProfile{"kasa2": {PrinterConfig: PrinterConfig{Host: "10.0.0.2"}}}
+			},
+			want: []string{"printers.kasa2.port"},
+		},
+		{
+			name: "profil o nazwie default",
+			change: func(c *Config) {
+				c.Printers = map[string]PrinterProfile{DefaultPrinter: {PrinterConfig: PrinterConfig{Host: "10.0.0.2", Port: 1}}}
+			},
+			want: []string{"printers.default"},
+		},
+		{
+			name: "nieprawidłowa nazwa profilu",
+			change: func(c *Config) {
+				c.Printers = map[string]PrinterProfile{"a/b": {PrinterConfig: PrinterConfig{Host: "10.0.0.2", Port: 1}}}
+			},
+			want: []string{"printers.a/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := CreateExampleConfig()
+			tt.change(cfg)
+			if got := problemPaths(t, cfg.Validate()); !slices.Equal(got, tt.want) {
+				t.Errorf("błędy w polach %v, oczekiwano %v", got, tt.want)
+			}
+		})
+	}
+}
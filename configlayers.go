@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "POSNET_"
+
+// Źródła wartości konfiguracji; wartości ze zmiennych i flag mają źródło
+// "env NAZWA" lub "flag -nazwa", a z profilu drukarki "file printers.nazwa".
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+)
+
+// ConfigOverride to wartość konfiguracji podana poza plikiem, np. flagą.
+type ConfigOverride struct {
+	Path   string
+	Value  string
+	Source string
+}
+
+// EffectiveValue to wartość konfiguracji po złożeniu warstw razem z jej
+// źródłem.
+type EffectiveValue struct {
+	Path   string      `json:"path"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// configField to pole proste konfiguracji (string, int, bool, []string)
+// z jego ścieżką JSON.
+type configField struct {
+	path  string
+	value reflect.Value
+}
+
+// configFields zwraca pola proste struktury v, wchodząc w zagnieżdżone
+// sekcje. Mapy i wskaźniki (profile drukarek) są pomijane.
+func configFields(v reflect.Value, prefix string) []configField {
+	var fields []configField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous {
+			fields = append(fields, configFields(fv, prefix)...)
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || name == "" {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			fields = append(fields, configFields(fv, prefix+name+".")...)
+		case reflect.String, reflect.Int, reflect.Bool:
+			fields = append(fields, configField{path: prefix + name, value: fv})
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.String {
+				fields = append(fields, configField{path: prefix + name, value: fv})
+			}
+		}
+	}
+	return fields
+}
+
+// envName zwraca nazwę zmiennej środowiskowej dla ścieżki JSON, np.
+// printer.host → POSNET_PRINTER_HOST.
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// setField ustawia pole z tekstu; listy są rozdzielone przecinkami.
+func setField(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("oczekiwano liczby całkowitej, jest %q", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("oczekiwano true lub false, jest %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		if s != "" {
+			for _, item := range strings.Split(s, ",") {
+				list = append(list, strings.TrimSpace(item))
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// jsonPaths wywołuje fn dla ścieżki każdej wartości z obiektu JSON; listy są
+// traktowane jak pojedyncze wartości.
+func jsonPaths(obj map[string]interface{}, prefix string, fn func(string)) {
+	for key, value := range obj {
+		if sub, ok := value.(map[string]interface{}); ok {
+			jsonPaths(sub, prefix+key+".", fn)
+			continue
+		}
+		fn(prefix + key)
+	}
+}
+
+// checkFields zgłasza klucze obiektu JSON, które nie odpowiadają żadnemu
+// polu typu t, np. literówki w nazwach ustawień, oraz wszystkie wartości
+// niezgodnego typu (json.Unmarshal zgłasza tylko pierwszą).
+func checkFields(obj map[string]interface{}, t reflect.Type, prefix string, e *ConfigError) {
+	known := jsonFieldTypes(t)
+	for _, key := range sortedKeys(obj) {
+		ft, ok := known[key]
+		if !ok {
+			e.add(prefix+key, "nieznane pole")
+			continue
+		}
+		checkValue(obj[key], ft, prefix+key, e)
+	}
+}
+
+// checkValue sprawdza, czy wartość JSON (liczby jako json.Number, a wstawione
+// przez migracje jako int) da się zapisać w polu typu t; null pozostawia
+// wartość bez zmian.
+func checkValue(value interface{}, t reflect.Type, path string, e *ConfigError) {
+	if value == nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if obj, ok := value.(map[string]interface{}); ok {
+			checkFields(obj, t, path+".", e)
+			return
+		}
+	case reflect.Map:
+		if obj, ok := value.(map[string]interface{}); ok {
+			for _, key := range sortedKeys(obj) {
+				checkValue(obj[key], t.Elem(), path+"."+key, e)
+			}
+			return
+		}
+	case reflect.Slice:
+		if list, ok := value.([]interface{}); ok {
+			for i, item := range list {
+				checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), e)
+			}
+			return
+		}
+	case reflect.String:
+		if _, ok := value.(string); ok {
+			return
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); ok {
+			return
+		}
+	case reflect.Int:
+		switch n := value.(type) {
+		case int:
+			// wartość wstawiona przez migrację
+			return
+		case json.Number:
+			if _, err := n.Int64(); err == nil {
+				return
+			}
+		}
+	default:
+		return
+	}
+	e.add(path, "nieprawidłowy typ wartości: %s, oczekiwano: %s", jsonKind(value), jsonKindOf(t))
+}
+
+// jsonKind opisuje rodzaj wartości JSON w komunikatach błędów.
+func jsonKind(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "tekst"
+	case json.Number:
+		return "liczba " + v.String()
+	case bool:
+		return "true/false"
+	case []interface{}:
+		return "lista"
+	}
+	return "obiekt"
+}
+
+// jsonKindOf opisuje rodzaj wartości JSON oczekiwany dla pola typu t.
+func jsonKindOf(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "tekst"
+	case reflect.Int:
+		return "liczba całkowita"
+	case reflect.Bool:
+		return "true/false"
+	case reflect.Slice:
+		return "lista"
+	}
+	return "obiekt"
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonFieldTypes zwraca typy pól struktury według nazw JSON, łącznie z polami
+// struktur osadzonych.
+func jsonFieldTypes(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous {
+			maps.Copy(fields, jsonFieldTypes(sf.Type))
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if !sf.IsExported() || name == "-" || name == "" {
+			continue
+		}
+		fields[name] = sf.Type
+	}
+	return fields
+}
+
+// defaultConfig zwraca warstwę wartości domyślnych: przykładową konfigurację
+// bez adresu drukarki, który trzeba podać w pliku, zmiennej lub fladze.
+func defaultConfig() *Config {
+	cfg := CreateExampleConfig()
+	cfg.Printer.Host = ""
+	return cfg
+}
+
+// LoadLayeredConfig składa konfigurację z warstw: wartości domyślnych
+// (defaultConfig), pliku path, zmiennych środowiskowych POSNET_*,
+// profilu drukarki printer i nadpisań overrides, np. z flag. Nieznane pola
+// pliku są błędem, a poprawność sprawdzana jest dla wyniku, więc późniejsza
+// warstwa może poprawić wartość z wcześniejszej. Wszystkie znalezione
+// problemy zwracane są razem jako *ConfigError.
+func LoadLayeredConfig(path, printer string, overrides []ConfigOverride) (*Config, error) {
+	cfg := defaultConfig()
+	cfg.sources = make(map[string]string)
+	fields := configFields(reflect.ValueOf(cfg).Elem(), "")
+	for _, f := range fields {
+		cfg.sources[f.path] = SourceDefault
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu pliku config: %w", err)
+	}
+	data, raw, migrated, err := upgradeJSON(path, data, configMigrations, ConfigVersion)
+	if err != nil {
+		return nil, err
+	}
+	cfg.migrated = migrated
+
+	problems := &ConfigError{}
+	checkFields(raw, reflect.TypeOf(*cfg), "", problems)
+	// niezgodne typy zgłosiło już checkFields; Unmarshal pomija takie
+	// wartości i wczytuje pozostałe
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(data, cfg); errors.As(err, &typeErr) {
+		if len(problems.Problems) == 0 {
+			problems.add(typeErr.Field, "nieprawidłowy typ wartości: %s, oczekiwano %s", typeErr.Value, typeErr.Type)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON: %w", err)
+	}
+	jsonPaths(raw, "", func(p string) {
+		if _, ok := cfg.sources[p]; ok {
+			cfg.sources[p] = SourceFile
+		}
+	})
+
+	// zmienne środowiskowe trafiają do konfiguracji głównej, aby dziedziczyły
+	// je drukarki wybierane później (kolumna store), a po wyborze profilu są
+	// stosowane ponownie, by miały pierwszeństwo przed jego wartościami
+	var env []ConfigOverride
+	for _, f := range fields {
+		name := envName(f.path)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(f.value, value); err != nil {
+			problems.add(f.path, "zmienna %s: %v", name, err)
+			continue
+		}
+		cfg.sources[f.path] = "env " + name
+		env = append(env, ConfigOverride{Path: f.path, Value: value, Source: "env " + name})
+	}
+
+	if cfg, err = cfg.ForPrinter(printer); err != nil {
+		return nil, err
+	}
+
+	overrides = append(env, overrides...)
+	if len(overrides) > 0 {
+		cfg.sources = maps.Clone(cfg.sources)
+		byPath := make(map[string]reflect.Value)
+		for _, f := range configFields(reflect.ValueOf(cfg).Elem(), "") {
+			byPath[f.path] = f.value
+		}
+		for _, o := range overrides {
+			v, ok := byPath[o.Path]
+			if !ok {
+				return nil, fmt.Errorf("nieznane ustawienie %s", o.Path)
+			}
+			if err := setField(v, o.Value); err != nil {
+				problems.add(o.Path, "%s: %v", o.Source, err)
+				continue
+			}
+			cfg.sources[o.Path] = o.Source
+		}
+	}
+
+	var invalid *ConfigError
+	if errors.As(cfg.Validate(), &invalid) {
+		for _, p := range invalid.Problems {
+			problems.add(p.Path, "%s", p.Message)
+		}
+	}
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// markProfileSources oznacza wartości przejęte z profilu drukarki name.
+func (c *Config) markProfileSources(name string, p PrinterProfile, root *Config) {
+	if root.sources == nil {
+		return
+	}
+	c.sources = maps.Clone(root.sources)
+	src := SourceFile + " printers." + name
+	for path := range c.sources {
+		switch {
+		case strings.HasPrefix(path, "printer."):
+			c.sources[path] = src
+		case strings.HasPrefix(path, "fiscal.") && p.Fiscal != nil:
+			c.sources[path] = src
+		case path == "encoding" && p.Encoding != "":
+			c.sources[path] = src
+		}
+	}
+	if p.Timeout == 0 {
+		c.sources["printer.timeout"] = root.sources["printer.timeout"]
+	}
+}
+
+// Effective zwraca wartości konfiguracji w kolejności pól razem z ich
+// źródłem. Klucz podpisu e-paragonów jest maskowany.
+func (c *Config) Effective() []EffectiveValue {
+	var values []EffectiveValue
+	for _, f := range configFields(reflect.ValueOf(c).Elem(), "") {
+		ev := EffectiveValue{Path: f.path, Value: f.value.Interface(), Source: c.sources[f.path]}
+		if ev.Source == "" {
+			ev.Source = SourceDefault
+		}
+		if f.path == "ereceipt.sign_key" && f.value.String() != "" {
+			ev.Value = "***"
+		}
+		values = append(values, ev)
+	}
+	return values
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestLoadLayeredConfigReportsAllProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		legacy bool
+		want   []string
+	}{
+		{
+			name: "poprawna",
+			json: `"printer": {"host": "10.0.0.1", "port": 6666}`,
+		},
+		{
+			name: "wszystkie niezgodne typy",
+			json: `"printer": {"host": "10.0.0.1", "port": "6666", "log_rx": 1, "timeout": 2.5},
+				"fiscal": {"vat_rates": ["23", 8]},
+				"data_backups": "3"`,
+			want: []string{"data_backups", "fiscal.vat_rates[1]", "printer.log_rx", "printer.port", "printer.timeout"},
+		},
+		{
+			name: "typy i nieznane pola w profilu drukarki",
+			json: `"printer": {"host": "10.0.0.1"},
+				"printers": {"kasa2": {"host": "10.0.0.2", "port": 6666, "log_tx": "tak", "hots": "x", "fiscal": {"vat_rate": "A"}}}`,
+			want: []string{"printers.kasa2.fiscal.vat_rate", "printers.kasa2.hots", "printers.kasa2.log_tx"},
+		},
+		{
+			name: "sekcja zamiast wartości i wartość zamiast sekcji",
+			json: `"printer": {"host": "10.0.0.1"}, "encoding": {"name": "cp1250"}, "log": "debug"`,
+			want: []string{"encoding", "log"},
+		},
+		{
+			name:   "plik bez wersji po migracji",
+			json:   `"printer": {"host": "10.0.0.1", "port": 6666, "timeout": 5}, "encoding": "cp1250"`,
+			legacy: true,
+		},
+		{
+			name: "null pozostawia wartość domyślną",
+			json: `"printer": {"host": "10.0.0.1", "timeout": null}`,
+		},
+		{
+			name: "brak adresu drukarki",
+			json: `"printer": {"port": 6666}`,
+			want: []string{"printer.host"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, fmt.Sprintf(`{"version": %d, %s}`, ConfigVersion, tt.json))
+			if tt.legacy {
+				path = writeTestConfig(t, "{"+tt.json+"}")
+			}
+			_, err := LoadLayeredConfig(path, "", nil)
+			got := problemPaths(t, err)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("błędy w polach %v, oczekiwano %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadLayeredConfigEnvOverridesProfile(t *testing.T) {
+	path := writeTestConfig(t, fmt.Sprintf(`{"version": %d,
+		"printer": {"host": "10.0.0.1", "port": 6666},
+		"printers": {"kasa2": {"host": "10.0.0.2", "port": 6666}}}`, ConfigVersion))
+	t.Setenv("POSNET_PRINTER_HOST", "10.0.0.9")
+
+	tests := []struct {
+		name    string
+		printer string
+		flags   []ConfigOverride
+		want    string
+		source  string
+	}{
+		{name: "drukarka domyślna", want: "10.0.0.9", source: "env POSNET_PRINTER_HOST"},
+		{name: "profil drukarki", printer: "kasa2", want: "10.0.0.9", source: "env POSNET_PRINTER_HOST"},
+		{
+			name:    "flaga przed zmienną",
+			printer: "kasa2",
+			flags:   []ConfigOverride{{Path: "printer.host", Value: "10.0.0.7", Source: "flag -host"}},
+			want:    "10.0.0.7",
+			source:  "flag -host",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadLayeredConfig(path, tt.printer, tt.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Printer.Host != tt.want {
+				t.Errorf("host = %s, oczekiwano %s", cfg.Printer.Host, tt.want)
+			}
+			if src := cfg.sources["printer.host"]; src != tt.source {
+				t.Errorf("źródło = %s, oczekiwano %s", src, tt.source)
+			}
+		})
+	}
+}
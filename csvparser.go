@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -10,18 +11,51 @@ import (
 )
 
 type Transaction struct {
-	Date   string
-	Amount int
+	Date    string `json:"date"`
+	Amount  int    `json:"amount"`
+	OrderID string `json:"order_id,omitempty"`
+
+	InvoiceNumber string `json:"invoice_number,omitempty"`
+	BuyerName     string `json:"buyer_name,omitempty"`
+	BuyerAddress  string `json:"buyer_address,omitempty"`
+	BuyerNIP      string `json:"buyer_nip,omitempty"`
+	PaymentTerm   string `json:"payment_term,omitempty"`
+	InvoiceCopies int    `json:"invoice_copies,omitempty"`
+
+	ReturnRef      string   `json:"return_ref,omitempty"`
+	ReturnProducts []string `json:"return_products,omitempty"`
+
+	Packaging []PackagingLine `json:"packaging,omitempty"`
+
+	Advance bool `json:"advance,omitempty"`
+	// Final oznacza paragon końcowy zamówienia, na którym odliczane są
+	// otwarte zaliczki.
+	Final bool `json:"final,omitempty"`
+
+	VoucherCode string `json:"voucher_code,omitempty"`
+
+	Store string `json:"store,omitempty"`
+}
+
+func (t *Transaction) IsInvoice() bool {
+	return t.BuyerNIP != ""
 }
 
-func ParseCSVFile(path string) ([]Transaction, error) {
+func (t *Transaction) IsReturn() bool {
+	return t.Amount < 0
+}
+
+// ReadCSVFile wczytuje transakcje z pliku CSV. Błędne linie są pomijane
+// i zwracane jako ostrzeżenia.
+func ReadCSVFile(path string) ([]Transaction, []string, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("błąd otwierania pliku %s: %w", path, err)
+		return nil, nil, fmt.Errorf("błąd otwierania pliku %s: %w", path, err)
 	}
 	defer file.Close()
 
 	var transactions []Transaction
+	var warnings []string
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
 
@@ -33,56 +67,230 @@ func ParseCSVFile(path string) ([]Transaction, error) {
 		}
 
 		parts := strings.Split(line, ";")
-		if len(parts) != 2 {
+		if len(parts) < 2 {
 			continue
 		}
 
 		date := strings.TrimSpace(parts[0])
 		amountStr := strings.TrimSpace(parts[1])
 
-		amountStr = strings.ReplaceAll(amountStr, ",", ".")
-		amountFloat, err := strconv.ParseFloat(amountStr, 64)
+		amountGr, err := parseAmount(amountStr)
 		if err != nil {
-			fmt.Printf("Ostrzeżenie: nie można sparsować kwoty w linii %d: %s\n", lineNum, line)
+			warnings = append(warnings, fmt.Sprintf("nie można sparsować kwoty w linii %d: %s", lineNum, line))
 			continue
 		}
 
-		amountGr := int(amountFloat*100 + 0.5)
-
-		transactions = append(transactions, Transaction{
+		trans := Transaction{
 			Date:   date,
 			Amount: amountGr,
-		})
+		}
+		if err := parseTransactionFields(parts[2:], &trans); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%v w linii %d: %s", err, lineNum, line))
+			continue
+		}
+
+		transactions = append(transactions, trans)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("błąd czytania pliku %s: %w", path, err)
+		return nil, warnings, fmt.Errorf("błąd czytania pliku %s: %w", path, err)
+	}
+
+	return transactions, warnings, nil
+}
+
+func parseTransactionFields(fields []string, t *Transaction) error {
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			if i == 0 {
+				t.OrderID = field
+				continue
+			}
+			return fmt.Errorf("nieprawidłowa kolumna %q (oczekiwano klucz=wartość)", field)
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "order":
+			t.OrderID = value
+		case "invoice":
+			t.InvoiceNumber = value
+		case "nip":
+			if err := validateNIP(value); err != nil {
+				return err
+			}
+			t.BuyerNIP = normalizeNIP(value)
+		case "buyer":
+			t.BuyerName = value
+		case "address":
+			t.BuyerAddress = value
+		case "term":
+			t.PaymentTerm = value
+		case "ref":
+			t.ReturnRef = value
+		case "product":
+			for _, name := range strings.Split(value, "|") {
+				if name = strings.TrimSpace(name); name != "" {
+					t.ReturnProducts = append(t.ReturnProducts, name)
+				}
+			}
+		case "pack", "packret":
+			for _, entry := range strings.Split(value, "|") {
+				pack, err := parsePackaging(entry, key == "packret")
+				if err != nil {
+					return err
+				}
+				t.Packaging = append(t.Packaging, pack)
+			}
+		case "type":
+			switch strings.ToLower(value) {
+			case "advance", "zaliczka":
+				t.Advance, t.Final = true, false
+			case "final", "rozliczenie":
+				t.Advance, t.Final = false, true
+			case "sale", "sprzedaz", "sprzedaż":
+				t.Advance, t.Final = false, false
+			default:
+				return fmt.Errorf("nieznany typ transakcji %q (użyj: sale|advance|final)", value)
+			}
+		case "voucher":
+			t.VoucherCode = normalizeVoucherCode(value)
+		case "store":
+			t.Store = value
+		case "copies":
+			copies, err := strconv.Atoi(value)
+			if err != nil || copies < 0 {
+				return fmt.Errorf("nieprawidłowa liczba kopii %q", value)
+			}
+			t.InvoiceCopies = copies
+		default:
+			return fmt.Errorf("nieznana kolumna %q", key)
+		}
+	}
+
+	if t.IsReturn() {
+		if t.ReturnRef == "" {
+			return fmt.Errorf("zwrot wymaga kolumny ref= z numerem paragonu")
+		}
+		if len(t.ReturnProducts) == 0 {
+			return fmt.Errorf("zwrot wymaga kolumny product=")
+		}
+		if t.IsInvoice() {
+			return fmt.Errorf("zwrot nie może być fakturą")
+		}
+		if len(t.Packaging) > 0 {
+			return fmt.Errorf("zwrot nie może zawierać opakowań")
+		}
+		if t.VoucherCode != "" {
+			return fmt.Errorf("zwrot nie może być rozliczony bonem")
+		}
+	} else if t.ReturnRef != "" || len(t.ReturnProducts) > 0 {
+		return fmt.Errorf("kolumny ref= i product= dozwolone tylko dla zwrotów (ujemna kwota)")
+	}
+
+	if t.Advance {
+		if t.OrderID == "" {
+			return fmt.Errorf("zaliczka wymaga numeru zamówienia (order=)")
+		}
+		if t.Amount <= 0 {
+			return fmt.Errorf("zaliczka wymaga dodatniej kwoty")
+		}
+	}
+
+	if t.Final {
+		if t.OrderID == "" {
+			return fmt.Errorf("rozliczenie zaliczek wymaga numeru zamówienia (order=)")
+		}
+		if t.Amount <= 0 {
+			return fmt.Errorf("rozliczenie zaliczek wymaga dodatniej kwoty")
+		}
+	}
+
+	if t.IsInvoice() {
+		if t.InvoiceNumber == "" {
+			t.InvoiceNumber = t.OrderID
+		}
+		if t.InvoiceNumber == "" {
+			return fmt.Errorf("faktura wymaga kolumny invoice= lub order=")
+		}
+		if t.BuyerName == "" {
+			return fmt.Errorf("faktura wymaga kolumny buyer=")
+		}
+	}
+	return nil
+}
+
+func parsePackaging(s string, returned bool) (PackagingLine, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 || strings.TrimSpace(parts[0]) == "" {
+		return PackagingLine{}, fmt.Errorf("nieprawidłowe opakowanie %q (oczekiwano nazwa:cena[:ilość])", s)
+	}
+
+	price, err := parseAmount(parts[1])
+	if err != nil || price <= 0 {
+		return PackagingLine{}, fmt.Errorf("nieprawidłowa cena opakowania %q", parts[1])
 	}
 
-	return transactions, nil
+	qty := 1.0
+	if len(parts) == 3 {
+		qty, err = strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(parts[2]), ",", "."), 64)
+		if err != nil || qty <= 0 {
+			return PackagingLine{}, fmt.Errorf("nieprawidłowa ilość opakowania %q", parts[2])
+		}
+	}
+
+	return PackagingLine{
+		Name:     strings.TrimSpace(parts[0]),
+		Price:    price,
+		Quantity: qty,
+		Returned: returned,
+	}, nil
+}
+
+func parseAmount(s string) (int, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	amountFloat, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Round(amountFloat * 100)), nil
 }
 
-func ParseCSVDirectory(dirPath string) ([]Transaction, error) {
+// ReadCSVDirectory wczytuje transakcje ze wszystkich plików CSV w katalogu.
+// Błędne linie i pliki, których nie da się odczytać, są pomijane i zwracane
+// jako ostrzeżenia z nazwą pliku.
+func ReadCSVDirectory(dirPath string) ([]Transaction, []string, error) {
 	files, err := filepath.Glob(filepath.Join(dirPath, "*.csv"))
 	if err != nil {
-		return nil, fmt.Errorf("błąd wyszukiwania plików CSV: %w", err)
+		return nil, nil, fmt.Errorf("błąd wyszukiwania plików CSV: %w", err)
 	}
 
 	if len(files) == 0 {
-		return nil, fmt.Errorf("nie znaleziono plików CSV w katalogu %s", dirPath)
+		return nil, nil, fmt.Errorf("nie znaleziono plików CSV w katalogu %s", dirPath)
 	}
 
 	var allTransactions []Transaction
+	var allWarnings []string
 	for _, file := range files {
-		transactions, err := ParseCSVFile(file)
+		transactions, warnings, err := ReadCSVFile(file)
+		for _, w := range warnings {
+			allWarnings = append(allWarnings, fmt.Sprintf("%s: %s", file, w))
+		}
 		if err != nil {
-			fmt.Printf("Ostrzeżenie: błąd parsowania %s: %v\n", file, err)
+			allWarnings = append(allWarnings, fmt.Sprintf("błąd parsowania %s: %v", file, err))
 			continue
 		}
 		allTransactions = append(allTransactions, transactions...)
 	}
 
-	return allTransactions, nil
+	return allTransactions, allWarnings, nil
 }
 
 func GroupByDate(transactions []Transaction) map[string][]Transaction {
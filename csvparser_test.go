@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTransactionFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int
+		fields  []string
+		want    Transaction
+		wantErr string
+	}{
+		{
+			name:   "numer zamówienia w pierwszej kolumnie",
+			amount: 12300,
+			fields: []string{"ZAM-1"},
+			want:   Transaction{Amount: 12300, OrderID: "ZAM-1"},
+		},
+		{
+			name:   "faktura z numerem zamówienia jako numerem faktury",
+			amount: 5000,
+			fields: []string{"order=ZAM-2", "nip=PL 526-025-02-74", "buyer=Firma"},
+			want:   Transaction{Amount: 5000, OrderID: "ZAM-2", InvoiceNumber: "ZAM-2", BuyerNIP: "5260250274", BuyerName: "Firma"},
+		},
+		{
+			name:    "faktura bez nabywcy",
+			amount:  5000,
+			fields:  []string{"invoice=FV/1", "nip=5260250274"},
+			wantErr: "buyer=",
+		},
+		{
+			name:    "błędna suma kontrolna NIP",
+			amount:  5000,
+			fields:  []string{"nip=5260250275"},
+			wantErr: "suma kontrolna",
+		},
+		{
+			name:   "zwrot",
+			amount: -2000,
+			fields: []string{"ref=P/1", "product=Sweter| Leginsy"},
+			want:   Transaction{Amount: -2000, ReturnRef: "P/1", ReturnProducts: []string{"Sweter", "Leginsy"}},
+		},
+		{
+			name:    "zwrot bez produktów",
+			amount:  -2000,
+			fields:  []string{"ref=P/1"},
+			wantErr: "product=",
+		},
+		{
+			name:    "produkty przy sprzedaży",
+			amount:  2000,
+			fields:  []string{"product=Sweter"},
+			wantErr: "tylko dla zwrotów",
+		},
+		{
+			name:    "zwrot rozliczony bonem",
+			amount:  -2000,
+			fields:  []string{"ref=P/1", "product=Sweter", "voucher=B1"},
+			wantErr: "bonem",
+		},
+		{
+			name:   "opakowania wydane i zwrócone",
+			amount: 1000,
+			fields: []string{"pack=Butelka:0,50:2", "packret=Skrzynka:10"},
+			want: Transaction{Amount: 1000, Packaging: []PackagingLine{
+				{Name: "Butelka", Price: 50, Quantity: 2},
+				{Name: "Skrzynka", Price: 1000, Quantity: 1, Returned: true},
+			}},
+		},
+		{
+			name:    "opakowanie bez ceny",
+			amount:  1000,
+			fields:  []string{"pack=Butelka"},
+			wantErr: "nieprawidłowe opakowanie",
+		},
+		{
+			name:   "zaliczka",
+			amount: 3000,
+			fields: []string{"order=ZAM-3", "type=zaliczka"},
+			want:   Transaction{Amount: 3000, OrderID: "ZAM-3", Advance: true},
+		},
+		{
+			name:   "rozliczenie zaliczek",
+			amount: 45000,
+			fields: []string{"order=ZAM-3", "type=final"},
+			want:   Transaction{Amount: 45000, OrderID: "ZAM-3", Final: true},
+		},
+		{
+			name:    "rozliczenie bez zamówienia",
+			amount:  45000,
+			fields:  []string{"type=rozliczenie"},
+			wantErr: "order=",
+		},
+		{
+			name:    "zaliczka bez zamówienia",
+			amount:  3000,
+			fields:  []string{"type=advance"},
+			wantErr: "order=",
+		},
+		{
+			name:   "bon, sklep i kopie",
+			amount: 3000,
+			fields: []string{"voucher= b1 ", "store=sklep2", "copies=2"},
+			want:   Transaction{Amount: 3000, VoucherCode: "B1", Store: "sklep2", InvoiceCopies: 2},
+		},
+		{
+			name:    "nieznana kolumna",
+			amount:  3000,
+			fields:  []string{"foo=bar"},
+			wantErr: "nieznana kolumna",
+		},
+		{
+			name:    "kolumna bez klucza poza pierwszą",
+			amount:  3000,
+			fields:  []string{"ZAM-1", "ZAM-2"},
+			wantErr: "klucz=wartość",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Transaction{Amount: tt.amount}
+			err := parseTransactionFields(tt.fields, &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nieoczekiwany błąd: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transakcja = %+v, oczekiwano %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"123,00", 12300, false},
+		{" 0.1 ", 10, false},
+		{"19,99", 1999, false},
+		{"-20,5", -2050, false},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseAmount(%q) = %d, %v; oczekiwano %d (błąd: %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReadCSVDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.csv": "2025-12-01; 123,00; ZAM-1\n2025-12-01; abc\n",
+		"b.csv": "2025-12-02; 50,00\n2025-12-02; 10,00; foo=bar\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transactions, warnings, err := ReadCSVDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 {
+		t.Errorf("wczytano %d transakcji, oczekiwano 2", len(transactions))
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("ostrzeżenia = %v, oczekiwano 2", warnings)
+	}
+	for i, name := range []string{"a.csv", "b.csv"} {
+		if !strings.Contains(warnings[i], name) {
+			t.Errorf("ostrzeżenie %q bez nazwy pliku %s", warnings[i], name)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const displayWidth = 20
+
+// displayDrainWait to czas oczekiwania na spóźnioną odpowiedź drukarki po
+// błędzie wyświetlacza.
+const displayDrainWait = 500 * time.Millisecond
+
+func (fc *FiscalClient) DisplayText(line1, line2 string) error {
+	for i, text := range []string{line1, line2} {
+		textBytes, err := encodeText(fc.enc, fitDisplay(text))
+		if err != nil {
+			return err
+		}
+
+		var payload []byte
+		payload = append(payload, []byte("dsptxtline")...)
+		payload = append(payload, TAB)
+		payload = append(payload, []byte("id0")...)
+		payload = append(payload, TAB)
+		payload = append(payload, []byte(fmt.Sprintf("no%d", i))...)
+		payload = append(payload, TAB)
+		payload = append(payload, []byte("s1")...)
+		payload = append(payload, textBytes...)
+		payload = append(payload, TAB)
+
+		if _, err := fc.query(context.Background(), "dsptxtline", payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fitDisplay(s string) string {
+	if utf8.RuneCountInString(s) <= displayWidth {
+		return s
+	}
+	return string([]rune(s)[:displayWidth])
+}
+
+func displayRow(left, right string) string {
+	left = fitDisplay(left)
+	pad := displayWidth - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if pad < 1 {
+		return fitDisplay(right)
+	}
+	return left + strings.Repeat(" ", pad) + right
+}
+
+func (fc *FiscalClient) displayLine(line ReceiptLine) error {
+	return fc.DisplayText(line.Name, displayRow(formatQuantity(line.Quantity)+" x", formatAmount(line.Price)))
+}
+
+func (fc *FiscalClient) displayTotal(total int) error {
+	return fc.DisplayText("SUMA", displayRow("PLN", formatAmount(total)))
+}
+
+// showOnDisplay wysyła tekst na wyświetlacz klienta w trakcie paragonu. Błąd
+// wyświetlacza nie przerywa paragonu, ale jest logowany, a spóźniona
+// odpowiedź jest odbierana, zanim zostanie wysłana kolejna ramka transakcji.
+// Inaczej odczytałaby ją następna komenda i dalsza część paragonu
+// rozminęłaby się z drukarką.
+func (fc *FiscalClient) showOnDisplay(show func() error) {
+	err := show()
+	if err == nil {
+		return
+	}
+	fc.logger.Warn("błąd wyświetlacza klienta", slog.Any("error", err))
+	if err := fc.drainResponses(displayDrainWait); err != nil {
+		fc.logger.Warn("błąd odpowiedzi wyświetlacza klienta", slog.Any("error", err))
+	}
+}
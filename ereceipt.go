@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	EReceiptPaper      = "paper"
+	EReceiptBoth       = "both"
+	EReceiptElectronic = "electronic"
+)
+
+type EReceiptLine struct {
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity"`
+	Price    int     `json:"price"`
+	Value    int     `json:"value"`
+	VATRate  string  `json:"vat_rate"`
+}
+
+type EReceiptAmount struct {
+	Name   string `json:"name"`
+	Amount int    `json:"amount"`
+}
+
+type EReceiptVAT struct {
+	Rate  string `json:"rate"`
+	Label string `json:"label"`
+	Net   int    `json:"net"`
+	VAT   int    `json:"vat"`
+	Gross int    `json:"gross"`
+}
+
+type EReceiptPayment struct {
+	Type   int    `json:"type"`
+	Name   string `json:"name,omitempty"`
+	Amount int    `json:"amount"`
+}
+
+type EReceipt struct {
+	OrderID       string            `json:"order_id,omitempty"`
+	Document      string            `json:"document"`
+	InvoiceNumber string            `json:"invoice_number,omitempty"`
+	BuyerNIP      string            `json:"buyer_nip,omitempty"`
+	Date          string            `json:"date"`
+	IssuedAt      time.Time         `json:"issued_at"`
+	PrinterNumber string            `json:"printer_number,omitempty"`
+	Lines         []EReceiptLine    `json:"lines"`
+	Advances      []EReceiptAmount  `json:"advances,omitempty"`
+	Packaging     []EReceiptAmount  `json:"packaging,omitempty"`
+	VAT           []EReceiptVAT     `json:"vat"`
+	Payments      []EReceiptPayment `json:"payments"`
+	Total         int               `json:"total"`
+	AmountDue     int               `json:"amount_due"`
+	Signature     string            `json:"signature,omitempty"`
+}
+
+func vatLetter(rate int) string {
+	if rate < 0 || rate > 6 {
+		return "?"
+	}
+	return string(rune('A' + rate))
+}
+
+func NewEReceipt(receipt *Receipt, inv *Invoice, t Transaction, defaultPaymentType int, vatTable VATTable, vat VATBreakdown) *EReceipt {
+	er := &EReceipt{
+		OrderID:       t.OrderID,
+		Document:      documentType(t),
+		Date:          t.Date,
+		IssuedAt:      time.Now(),
+		PrinterNumber: receipt.PrinterNumber,
+		Total:         receipt.Total,
+		AmountDue:     receipt.AmountDue(),
+	}
+	if inv != nil {
+		er.InvoiceNumber = inv.Number
+		er.BuyerNIP = inv.BuyerNIP
+	}
+
+	for _, line := range receipt.Lines {
+		er.Lines = append(er.Lines, EReceiptLine{
+			Name:     line.Name,
+			Quantity: normalizeQuantity(line.Quantity),
+			Price:    line.Price,
+			Value:    lineValue(line.Price, line.Quantity),
+			VATRate:  vatLetter(line.VATRate),
+		})
+	}
+	for _, adv := range receipt.Advances {
+		er.Advances = append(er.Advances, EReceiptAmount{Name: adv.Name, Amount: adv.Amount})
+	}
+	for _, pack := range receipt.Packaging {
+		amount := lineValue(pack.Price, pack.Quantity)
+		if pack.Returned {
+			amount = -amount
+		}
+		er.Packaging = append(er.Packaging, EReceiptAmount{Name: pack.Name, Amount: amount})
+	}
+	er.VAT = vatSummary(vat, vatTable)
+	for _, p := range receipt.paymentsWithDefault(defaultPaymentType) {
+		er.Payments = append(er.Payments, EReceiptPayment{Type: p.Type, Name: p.Name, Amount: p.Amount})
+	}
+
+	return er
+}
+
+func vatSummary(vat VATBreakdown, vatTable VATTable) []EReceiptVAT {
+	var out []EReceiptVAT
+	for _, e := range vat {
+		out = append(out, EReceiptVAT{
+			Rate:  vatLetter(e.Index),
+			Label: vatTable.Label(e.Index),
+			Net:   e.Net,
+			VAT:   e.VAT,
+			Gross: e.Gross,
+		})
+	}
+	return out
+}
+
+func (er *EReceipt) Sign(key string) error {
+	er.Signature = ""
+	data, err := json.Marshal(er)
+	if err != nil {
+		return fmt.Errorf("błąd serializacji e-paragonu: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	er.Signature = hex.EncodeToString(mac.Sum(nil))
+	return nil
+}
+
+// fileName zwraca nazwę pliku e-paragonu: numer zamówienia (lub datę), rodzaj
+// dokumentu i numer wydruku (lub czas wystawienia). Zaliczka, paragon końcowy
+// i faktura do tego samego zamówienia trafiają więc do osobnych plików.
+func (er *EReceipt) fileName() string {
+	name := er.OrderID
+	if name == "" {
+		name = er.Date
+	}
+	number := er.PrinterNumber
+	if number == "" {
+		number = er.IssuedAt.Format("20060102T150405.000000000")
+	}
+	return safeFileName(name+"_"+er.Document+"_"+number) + ".json"
+}
+
+// WriteEReceipt zapisuje e-paragon do katalogu outbox przez plik tymczasowy,
+// żeby program wysyłający nigdy nie odczytał niepełnego pliku. Istniejący
+// plik, np. już wysłany e-paragon, nigdy nie jest zastępowany.
+func WriteEReceipt(outbox, key string, er *EReceipt) (string, error) {
+	if err := er.Sign(key); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(er, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("błąd serializacji e-paragonu: %w", err)
+	}
+
+	if err := os.MkdirAll(outbox, 0755); err != nil {
+		return "", fmt.Errorf("błąd tworzenia katalogu %s: %w", outbox, err)
+	}
+
+	path := filepath.Join(outbox, er.fileName())
+	tmp, err := os.CreateTemp(outbox, "."+er.fileName()+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("błąd zapisu e-paragonu: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("błąd zapisu e-paragonu: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("błąd zapisu e-paragonu: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("błąd zapisu e-paragonu: %w", err)
+	}
+
+	// w przeciwieństwie do rename dowiązanie, tak jak O_EXCL, kończy się
+	// błędem, gdy plik docelowy już istnieje
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("e-paragon %s już istnieje", path)
+		}
+		return "", fmt.Errorf("błąd zapisu e-paragonu: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEReceiptFileName(t *testing.T) {
+	issued := time.Date(2025, 12, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		er   EReceipt
+		want string
+	}{
+		{
+			name: "paragon końcowy",
+			er:   EReceipt{OrderID: "ZAM/2025/0012", Document: "rozliczenie", PrinterNumber: "125"},
+			want: "ZAM_2025_0012_rozliczenie_125.json",
+		},
+		{
+			name: "zaliczka do tego samego zamówienia",
+			er:   EReceipt{OrderID: "ZAM/2025/0012", Document: "zaliczka", PrinterNumber: "118"},
+			want: "ZAM_2025_0012_zaliczka_118.json",
+		},
+		{
+			name: "bez zamówienia i numeru wydruku",
+			er:   EReceipt{Date: "2025-12-01", Document: "paragon", IssuedAt: issued},
+			want: "2025-12-01_paragon_20251201T103000.000000000.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.er.fileName(); got != tt.want {
+				t.Errorf("fileName() = %q, oczekiwano %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteEReceipt(t *testing.T) {
+	outbox := t.TempDir()
+	er := &EReceipt{OrderID: "ZAM-1", Document: "paragon", Date: "2025-12-01", PrinterNumber: "7", Total: 1000}
+
+	path, err := WriteEReceipt(outbox, "klucz", er)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(outbox, "ZAM-1_paragon_7.json"); path != want {
+		t.Fatalf("ścieżka = %q, oczekiwano %q", path, want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved EReceipt
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	signature := saved.Signature
+	saved.Signature = ""
+	unsigned, _ := json.Marshal(saved)
+	mac := hmac.New(sha256.New, []byte("klucz"))
+	mac.Write(unsigned)
+	if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("podpis = %q, oczekiwano %q", signature, want)
+	}
+
+	if _, err := WriteEReceipt(outbox, "klucz", &EReceipt{OrderID: "ZAM-1", Document: "paragon", PrinterNumber: "7", Total: 2000}); err == nil {
+		t.Fatal("oczekiwano błędu przy istniejącym e-paragonie")
+	}
+	if again, _ := os.ReadFile(path); string(again) != string(data) {
+		t.Error("istniejący e-paragon został nadpisany")
+	}
+	entries, _ := os.ReadDir(outbox)
+	if len(entries) != 1 {
+		t.Errorf("w outbox zostały pliki tymczasowe: %v", entries)
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 )
@@ -11,6 +13,7 @@ type FiscalClient struct {
 	*Client
 	vatRate     int
 	paymentType int
+	display     bool
 }
 
 func NewFiscalClient(c *Client, vatRate, paymentType int) *FiscalClient {
@@ -21,6 +24,10 @@ func NewFiscalClient(c *Client, vatRate, paymentType int) *FiscalClient {
 	}
 }
 
+func (fc *FiscalClient) SetCustomerDisplay(enabled bool) {
+	fc.display = enabled
+}
+
 type ReceiptLine struct {
 	Name     string
 	Price    int
@@ -28,9 +35,128 @@ type ReceiptLine struct {
 	VATRate  int
 }
 
+type PackagingLine struct {
+	Name     string
+	Price    int
+	Quantity float64
+	Returned bool
+}
+
+type AdvanceDeduction struct {
+	Name    string
+	Amount  int
+	VATRate int
+}
+
+type Payment struct {
+	Type   int
+	Name   string
+	Amount int
+}
+
+type FooterLineType int
+
+const (
+	FooterInfo         FooterLineType = 0
+	FooterOrderNumber  FooterLineType = 1
+	FooterSystemNumber FooterLineType = 2
+)
+
+type FooterLine struct {
+	Type FooterLineType
+	Text string
+}
+
 type Receipt struct {
-	Lines []ReceiptLine
-	Total int
+	Lines     []ReceiptLine
+	Total     int
+	Advances  []AdvanceDeduction
+	Packaging []PackagingLine
+	Payments  []Payment
+	Footer    []FooterLine
+
+	// Electronic wystawia paragon jako e-paragon (bez wydruku papierowego).
+	Electronic bool
+	// PrinterNumber to numer wydruku zwrócony przez drukarkę w odpowiedzi na trend.
+	PrinterNumber string
+}
+
+func (r *Receipt) PackagingTotals() (sold, returned int) {
+	for _, p := range r.Packaging {
+		if p.Returned {
+			returned += lineValue(p.Price, p.Quantity)
+		} else {
+			sold += lineValue(p.Price, p.Quantity)
+		}
+	}
+	return sold, returned
+}
+
+func (r *Receipt) AdvancesTotal() int {
+	total := 0
+	for _, a := range r.Advances {
+		total += a.Amount
+	}
+	return total
+}
+
+func (r *Receipt) AmountDue() int {
+	sold, returned := r.PackagingTotals()
+	return r.Total - r.AdvancesTotal() + sold - returned
+}
+
+func (r *Receipt) PaymentsTotal() int {
+	total := 0
+	for _, p := range r.Payments {
+		total += p.Amount
+	}
+	return total
+}
+
+// Validate sprawdza kwoty paragonu. Jest wywoływana przed wysłaniem pierwszej
+// ramki, bo błąd wykryty po trinit zostawiłby na drukarce otwartą transakcję.
+func (r *Receipt) Validate() error {
+	if len(r.Lines) == 0 {
+		return fmt.Errorf("paragon bez pozycji")
+	}
+	if r.AdvancesTotal() > r.Total {
+		return fmt.Errorf("zaliczki %d gr przekraczają wartość paragonu %d gr", r.AdvancesTotal(), r.Total)
+	}
+	if r.AmountDue() < 0 {
+		return fmt.Errorf("kwota do zapłaty ujemna: %d gr (zwrot opakowań przekracza sprzedaż)", r.AmountDue())
+	}
+	for _, p := range r.Payments {
+		if p.Amount <= 0 {
+			return fmt.Errorf("płatność %s: kwota musi być dodatnia", p.Name)
+		}
+	}
+	if r.PaymentsTotal() > r.AmountDue() {
+		return fmt.Errorf("płatności %d gr przekraczają kwotę do zapłaty %d gr", r.PaymentsTotal(), r.AmountDue())
+	}
+	return nil
+}
+
+func (r *Receipt) paymentsWithDefault(defaultType int) []Payment {
+	payments := append([]Payment(nil), r.Payments...)
+	if rest := r.AmountDue() - r.PaymentsTotal(); rest > 0 || len(payments) == 0 {
+		payments = append(payments, Payment{Type: defaultType, Amount: rest})
+	}
+	return payments
+}
+
+func normalizeQuantity(qty float64) float64 {
+	if qty <= 0 {
+		return 1.0
+	}
+	return qty
+}
+
+func formatQuantity(qty float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", normalizeQuantity(qty)), "0"), ".")
+}
+
+func lineValue(price int, qty float64) int {
+	return int(float64(price) * normalizeQuantity(qty))
 }
 
 func (fc *FiscalClient) DailyReport(date string) error {
@@ -100,16 +226,71 @@ func (fc *FiscalClient) MonthlyReport(date string, summary bool) error {
 	return nil
 }
 
+// Status odczytuje stan urządzenia (sdev) i zwraca pola odpowiedzi.
+func (fc *FiscalClient) Status() (map[string]string, error) {
+	var payload []byte
+	payload = append(payload, []byte("sdev")...)
+	payload = append(payload, TAB)
+
+	return fc.query(context.Background(), "sdev", payload)
+}
+
 func (fc *FiscalClient) PrintReceipt(receipt *Receipt) error {
+	if err := receipt.Validate(); err != nil {
+		return &NotPrintedError{Err: err}
+	}
+
 	ctx := context.Background()
 
-	if err := fc.sendTrinit(); err != nil {
-		return fmt.Errorf("błąd trinit: %w", err)
+	if err := fc.sendTrinit(receipt); err != nil {
+		return &NotPrintedError{Err: fmt.Errorf("błąd trinit: %w", err)}
 	}
 	if err := fc.readResponse(ctx, "trinit"); err != nil {
 		return err
 	}
 
+	if err := fc.sendTransaction(ctx, receipt); err != nil {
+		return fc.cancelTransaction(ctx, err)
+	}
+	return nil
+}
+
+// NotPrintedError oznacza błąd, po którym dokument na pewno nie został
+// wydrukowany: wystąpił przed wysłaniem trinit lub trfvinit albo drukarka
+// potwierdziła anulowanie transakcji. Po innych błędach wydruku nie wiadomo,
+// czy dokument powstał.
+type NotPrintedError struct {
+	Err error
+}
+
+func (e *NotPrintedError) Error() string { return e.Err.Error() }
+
+func (e *NotPrintedError) Unwrap() error { return e.Err }
+
+// cancelTransaction anuluje transakcję otwartą przez trinit lub trfvinit po
+// błędzie cause, aby następny dokument nie trafił do niedokończonego
+// paragonu. Przed anulowaniem odbierane są spóźnione odpowiedzi na
+// wcześniejsze ramki. Potwierdzone anulowanie zwraca *NotPrintedError.
+func (fc *FiscalClient) cancelTransaction(ctx context.Context, cause error) error {
+	if errors.Is(cause, io.EOF) {
+		return fmt.Errorf("%w (transakcja nie została anulowana - utracono połączenie)", cause)
+	}
+	_ = fc.drainResponses(500 * time.Millisecond)
+
+	var payload []byte
+	payload = append(payload, []byte("trcancel")...)
+	payload = append(payload, TAB)
+
+	if err := fc.SendBytes(payload); err != nil {
+		return fmt.Errorf("%w (błąd anulowania transakcji: %v)", cause, err)
+	}
+	if err := fc.readResponse(ctx, "trcancel"); err != nil {
+		return fmt.Errorf("%w (błąd anulowania transakcji: %v)", cause, err)
+	}
+	return &NotPrintedError{Err: fmt.Errorf("%w (transakcja anulowana)", cause)}
+}
+
+func (fc *FiscalClient) sendTransaction(ctx context.Context, receipt *Receipt) error {
 	for i, line := range receipt.Lines {
 		if err := fc.sendTrline(line); err != nil {
 			return fmt.Errorf("błąd trline #%d: %w", i, err)
@@ -117,32 +298,70 @@ func (fc *FiscalClient) PrintReceipt(receipt *Receipt) error {
 		if err := fc.readResponse(ctx, "trline"); err != nil {
 			return err
 		}
+		if fc.display {
+			fc.showOnDisplay(func() error { return fc.displayLine(line) })
+		}
 	}
 
-	if err := fc.sendTrpayment(receipt.Total); err != nil {
-		return fmt.Errorf("błąd trpayment: %w", err)
-	}
-	if err := fc.readResponse(ctx, "trpayment"); err != nil {
+	if err := fc.sendAdvances(ctx, receipt); err != nil {
 		return err
 	}
 
-	if err := fc.sendTrend(receipt.Total); err != nil {
+	for i, pack := range receipt.Packaging {
+		if err := fc.sendTrpack(pack); err != nil {
+			return fmt.Errorf("błąd trpack #%d: %w", i, err)
+		}
+		if err := fc.readResponse(ctx, "trpack"); err != nil {
+			return err
+		}
+	}
+
+	if fc.display {
+		fc.showOnDisplay(func() error { return fc.displayTotal(receipt.AmountDue()) })
+	}
+
+	for i, payment := range receipt.paymentsWithDefault(fc.paymentType) {
+		if err := fc.sendTrpayment(payment); err != nil {
+			return fmt.Errorf("błąd trpayment #%d: %w", i, err)
+		}
+		if err := fc.readResponse(ctx, "trpayment"); err != nil {
+			return err
+		}
+	}
+
+	for i, line := range receipt.Footer {
+		if err := fc.sendTrftrln(line); err != nil {
+			return fmt.Errorf("błąd trftrln #%d: %w", i, err)
+		}
+		if err := fc.readResponse(ctx, "trftrln"); err != nil {
+			return err
+		}
+	}
+
+	if err := fc.sendTrend(receipt); err != nil {
 		return fmt.Errorf("błąd trend: %w", err)
 	}
-	if err := fc.readResponse(ctx, "trend"); err != nil {
+	fields, err := fc.readResponseFields(ctx, "trend")
+	if err != nil {
 		return err
 	}
+	receipt.PrinterNumber = fields["bn"]
 
 	return nil
 }
 
-func (fc *FiscalClient) sendTrinit() error {
+func (fc *FiscalClient) sendTrinit(receipt *Receipt) error {
 	var payload []byte
 	payload = append(payload, []byte("trinit")...)
 	payload = append(payload, TAB)
 	payload = append(payload, []byte("bm0")...)
 	payload = append(payload, TAB)
 
+	if receipt.Electronic {
+		payload = append(payload, []byte("ep1")...)
+		payload = append(payload, TAB)
+	}
+
 	return fc.SendBytes(payload)
 }
 
@@ -170,30 +389,34 @@ func (fc *FiscalClient) sendTrline(line ReceiptLine) error {
 	payload = append(payload, []byte(fmt.Sprintf("pr%d", line.Price))...)
 	payload = append(payload, TAB)
 
-	qty := line.Quantity
-	if qty <= 0 {
-		qty = 1.0
-	}
-	qtyStr := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", qty), "0"), ".")
-	payload = append(payload, []byte(fmt.Sprintf("il%s", qtyStr))...)
+	payload = append(payload, []byte("il"+formatQuantity(line.Quantity))...)
 	payload = append(payload, TAB)
 
-	total := int(float64(line.Price) * qty)
-	payload = append(payload, []byte(fmt.Sprintf("wa%d", total))...)
+	payload = append(payload, []byte(fmt.Sprintf("wa%d", lineValue(line.Price, line.Quantity)))...)
 	payload = append(payload, TAB)
 
 	return fc.SendBytes(payload)
 }
 
-func (fc *FiscalClient) sendTrpayment(amount int) error {
+func (fc *FiscalClient) sendTrpayment(payment Payment) error {
 	var payload []byte
 	payload = append(payload, []byte("trpayment")...)
 	payload = append(payload, TAB)
 
-	payload = append(payload, []byte(fmt.Sprintf("ty%d", fc.paymentType))...)
+	payload = append(payload, []byte(fmt.Sprintf("ty%d", payment.Type))...)
 	payload = append(payload, TAB)
 
-	payload = append(payload, []byte(fmt.Sprintf("wa%d", amount))...)
+	if payment.Name != "" {
+		nameBytes, err := encodeText(fc.enc, payment.Name)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, []byte("na")...)
+		payload = append(payload, nameBytes...)
+		payload = append(payload, TAB)
+	}
+
+	payload = append(payload, []byte(fmt.Sprintf("wa%d", payment.Amount))...)
 	payload = append(payload, TAB)
 
 	payload = append(payload, []byte("re0")...)
@@ -202,15 +425,83 @@ func (fc *FiscalClient) sendTrpayment(amount int) error {
 	return fc.SendBytes(payload)
 }
 
-func (fc *FiscalClient) sendTrend(total int) error {
+func (fc *FiscalClient) sendTrftrln(line FooterLine) error {
+	textBytes, err := encodeText(fc.enc, line.Text)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	payload = append(payload, []byte("trftrln")...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte(fmt.Sprintf("id%d", line.Type))...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte("na")...)
+	payload = append(payload, textBytes...)
+	payload = append(payload, TAB)
+
+	return fc.SendBytes(payload)
+}
+
+func (fc *FiscalClient) sendTrpack(pack PackagingLine) error {
+	nameBytes, err := encodeText(fc.enc, pack.Name)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	payload = append(payload, []byte("trpack")...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte("na")...)
+	payload = append(payload, nameBytes...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte(fmt.Sprintf("pr%d", pack.Price))...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte("il"+formatQuantity(pack.Quantity))...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte(fmt.Sprintf("wa%d", lineValue(pack.Price, pack.Quantity)))...)
+	payload = append(payload, TAB)
+
+	if pack.Returned {
+		payload = append(payload, []byte("sp1")...)
+	} else {
+		payload = append(payload, []byte("sp0")...)
+	}
+	payload = append(payload, TAB)
+
+	return fc.SendBytes(payload)
+}
+
+func (fc *FiscalClient) sendTrend(receipt *Receipt) error {
 	var payload []byte
 	payload = append(payload, []byte("trend")...)
 	payload = append(payload, TAB)
 
-	payload = append(payload, []byte(fmt.Sprintf("to%d", total))...)
+	payload = append(payload, []byte(fmt.Sprintf("to%d", receipt.Total))...)
 	payload = append(payload, TAB)
 
-	payload = append(payload, []byte(fmt.Sprintf("fp%d", total))...)
+	if advances := receipt.AdvancesTotal(); advances > 0 {
+		payload = append(payload, []byte(fmt.Sprintf("za%d", advances))...)
+		payload = append(payload, TAB)
+	}
+
+	sold, returned := receipt.PackagingTotals()
+	if sold > 0 {
+		payload = append(payload, []byte(fmt.Sprintf("op%d", sold))...)
+		payload = append(payload, TAB)
+	}
+	if returned > 0 {
+		payload = append(payload, []byte(fmt.Sprintf("om%d", returned))...)
+		payload = append(payload, TAB)
+	}
+
+	payload = append(payload, []byte(fmt.Sprintf("fp%d", receipt.AmountDue()))...)
 	payload = append(payload, TAB)
 
 	payload = append(payload, []byte("re0")...)
@@ -223,20 +514,47 @@ func (fc *FiscalClient) sendTrend(total int) error {
 }
 
 func (fc *FiscalClient) readResponse(ctx context.Context, cmd string) error {
+	_, err := fc.readResponseFields(ctx, cmd)
+	return err
+}
+
+func (fc *FiscalClient) readResponseFields(ctx context.Context, cmd string) (map[string]string, error) {
 	readCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	resp, err := fc.ReadFrame(readCtx)
 	if err != nil {
-		return fmt.Errorf("błąd odczytu odpowiedzi dla %s: %w", cmd, err)
+		return nil, fmt.Errorf("błąd odczytu odpowiedzi dla %s: %w", cmd, err)
 	}
 
 	if strings.Contains(resp, "ERR") {
-		return fmt.Errorf("błąd wykonania %s: %s", cmd, resp)
+		return nil, fmt.Errorf("błąd wykonania %s: %s", cmd, resp)
 	}
 	if strings.Contains(resp, "?") && !strings.Contains(resp, cmd) {
-		return fmt.Errorf("błąd wykonania %s: %s", cmd, resp)
+		return nil, fmt.Errorf("błąd wykonania %s: %s", cmd, resp)
 	}
 
-	return nil
+	_, fields := parseResponse(resp)
+	return fields, nil
+}
+
+func (fc *FiscalClient) query(ctx context.Context, cmd string, payload []byte) (map[string]string, error) {
+	if err := fc.SendBytes(payload); err != nil {
+		return nil, fmt.Errorf("błąd wysyłania %s: %w", cmd, err)
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	resp, err := fc.ReadFrame(readCtx)
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu odpowiedzi dla %s: %w", cmd, err)
+	}
+
+	name, fields := parseResponse(resp)
+	if name != cmd {
+		return nil, fmt.Errorf("błąd wykonania %s: %s", cmd, sanitizeASCII(resp))
+	}
+
+	return fields, nil
 }
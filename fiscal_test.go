@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePrinter to drukarka po drugiej stronie net.Pipe: zapisuje nazwy
+// odebranych komend i odpowiada ramką zwróconą przez reply.
+type fakePrinter struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (p *fakePrinter) Commands() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.commands...)
+}
+
+func newFakePrinter(t *testing.T, reply func(cmd string) string) (*FiscalClient, *fakePrinter) {
+	t.Helper()
+	client, server := net.Pipe()
+	p := &fakePrinter{}
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srv := newClient(server, EncCP1250, time.Minute)
+	srv.SetLogger(quiet)
+	// odpowiedzi wysyłane osobno, bo komendy formularzy nie czekają na
+	// odpowiedź, a net.Pipe nie buforuje zapisów
+	replies := make(chan string, 64)
+	go func() {
+		for r := range replies {
+			if err := srv.Send(r); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer server.Close()
+		defer close(replies)
+		for {
+			payload, err := srv.ReadFrame(context.Background())
+			if err != nil {
+				return
+			}
+			cmd, _, _ := strings.Cut(payload, "\t")
+			p.mu.Lock()
+			p.commands = append(p.commands, cmd)
+			p.mu.Unlock()
+			replies <- reply(cmd)
+		}
+	}()
+
+	c := newClient(client, EncCP1250, time.Second)
+	c.SetLogger(quiet)
+	t.Cleanup(func() { c.Close() })
+	return NewFiscalClient(c, 0, 8), p
+}
+
+func okReply(cmd string) string {
+	if cmd == "trend" {
+		return "trend\tbn7\t"
+	}
+	return cmd + "\t"
+}
+
+func testReceipt() *Receipt {
+	return &Receipt{
+		Lines: []ReceiptLine{{Name: "Sweter", Price: 10000, Quantity: 1}},
+		Total: 10000,
+	}
+}
+
+func TestReceiptValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(r *Receipt)
+		wantErr string
+	}{
+		{name: "poprawny", change: func(r *Receipt) {}},
+		{
+			name:    "bez pozycji",
+			change:  func(r *Receipt) { r.Lines = nil },
+			wantErr: "bez pozycji",
+		},
+		{
+			name:   "zaliczka równa wartości",
+			change: func(r *Receipt) { r.Advances = []AdvanceDeduction{{Amount: 10000}} },
+		},
+		{
+			name:    "zaliczki większe niż paragon",
+			change:  func(r *Receipt) { r.Advances = []AdvanceDeduction{{Amount: 6000}, {Amount: 5000}} },
+			wantErr: "zaliczki",
+		},
+		{
+			name:    "zwrot opakowań większy niż sprzedaż",
+			change:  func(r *Receipt) { r.Packaging = []PackagingLine{{Name: "Skrzynka", Price: 20000, Returned: true}} },
+			wantErr: "ujemna",
+		},
+		{
+			name:    "płatności większe niż kwota do zapłaty",
+			change:  func(r *Receipt) { r.Payments = []Payment{{Name: "Bon", Amount: 10001}} },
+			wantErr: "płatności",
+		},
+		{
+			name:    "płatność zerowa",
+			change:  func(r *Receipt) { r.Payments = []Payment{{Name: "Bon"}} },
+			wantErr: "dodatnia",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReceipt()
+			tt.change(r)
+			err := r.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("nieoczekiwany błąd: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrintReceiptValidatesBeforeTrinit(t *testing.T) {
+	fc, printer := newFakePrinter(t, okReply)
+	r := testReceipt()
+	r.Advances = []AdvanceDeduction{{Amount: 20000}}
+
+	if err := fc.PrintReceipt(r); err == nil {
+		t.Fatal("oczekiwano błędu walidacji")
+	}
+	if cmds := printer.Commands(); len(cmds) != 0 {
+		t.Fatalf("wysłano ramki mimo błędu walidacji: %v", cmds)
+	}
+}
+
+func TestPrintReceiptCancelsAfterError(t *testing.T) {
+	fc, printer := newFakePrinter(t, func(cmd string) string {
+		if cmd == "trpayment" {
+			return "?\tERR12\t"
+		}
+		return okReply(cmd)
+	})
+
+	err := fc.PrintReceipt(testReceipt())
+	if err == nil || !strings.Contains(err.Error(), "anulowana") {
+		t.Fatalf("błąd = %v, oczekiwano anulowania transakcji", err)
+	}
+	cmds := printer.Commands()
+	if len(cmds) == 0 || cmds[len(cmds)-1] != "trcancel" {
+		t.Fatalf("komendy = %v, oczekiwano trcancel na końcu", cmds)
+	}
+}
+
+func TestPrintReceipt(t *testing.T) {
+	fc, printer := newFakePrinter(t, okReply)
+	r := testReceipt()
+
+	if err := fc.PrintReceipt(r); err != nil {
+		t.Fatalf("nieoczekiwany błąd: %v", err)
+	}
+	if r.PrinterNumber != "7" {
+		t.Errorf("numer wydruku = %q, oczekiwano 7", r.PrinterNumber)
+	}
+	want := []string{"trinit", "trline", "trpayment", "trend"}
+	if got := printer.Commands(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("komendy = %v, oczekiwano %v", got, want)
+	}
+}
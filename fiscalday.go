@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	ReportPrinted = "printed"
+	ReportFailed  = "failed"
+
+	fiscalDayHistory = 200
+)
+
+// ReportRecord to wynik jednej próby wydruku raportu dobowego.
+type ReportRecord struct {
+	Date      string    `json:"date"`
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source,omitempty"`
+	Status    string    `json:"status"`
+	Documents int       `json:"documents"`
+	Retryable bool      `json:"retryable,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// FiscalDayLedger śledzi dokumenty wydrukowane od ostatniego raportu
+// dobowego. OpenDate to dzień pierwszego z nich; dopóki raport nie zostanie
+// wydrukowany, kolejnego dnia nie można drukować nowych dokumentów.
+type FiscalDayLedger struct {
+	OpenDate   string         `json:"open_date,omitempty"`
+	Documents  int            `json:"documents"`
+	LastReport time.Time      `json:"last_report,omitzero"`
+	Reports    []ReportRecord `json:"reports,omitempty"`
+}
+
+func LoadFiscalDay(path string) (*FiscalDayLedger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &FiscalDayLedger{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu rejestru dnia fiskalnego: %w", err)
+	}
+
+	var ledger FiscalDayLedger
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON rejestru dnia fiskalnego: %w", err)
+	}
+	return &ledger, nil
+}
+
+func (l *FiscalDayLedger) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji JSON rejestru dnia fiskalnego: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru dnia fiskalnego: %w", err)
+	}
+	return nil
+}
+
+func fiscalDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func (l *FiscalDayLedger) AddDocument(now time.Time) {
+	if l.Documents == 0 {
+		l.OpenDate = fiscalDate(now)
+	}
+	l.Documents++
+}
+
+// AddReport zapisuje wynik próby raportu; udany raport zamyka dzień.
+func (l *FiscalDayLedger) AddReport(rec ReportRecord) {
+	rec.Documents = l.Documents
+	l.Reports = append(l.Reports, rec)
+	if len(l.Reports) > fiscalDayHistory {
+		l.Reports = l.Reports[len(l.Reports)-fiscalDayHistory:]
+	}
+	if rec.Status == ReportPrinted {
+		l.OpenDate = ""
+		l.Documents = 0
+		l.LastReport = rec.Time
+	}
+}
+
+// MissingReport zwraca dzień, za który brakuje raportu dobowego, jeśli
+// jest wcześniejszy niż bieżący.
+func (l *FiscalDayLedger) MissingReport(now time.Time) string {
+	if l.Documents > 0 && l.OpenDate != "" && l.OpenDate < fiscalDate(now) {
+		return l.OpenDate
+	}
+	return ""
+}
+
+// FailedAttempts zwraca nieudane próby raportu z danego źródła wykonane
+// od początku dnia now i po ostatnim udanym raporcie (z dowolnego źródła).
+func (l *FiscalDayLedger) FailedAttempts(source string, now time.Time) []ReportRecord {
+	today := fiscalDate(now)
+	var attempts []ReportRecord
+	for _, rec := range l.Reports {
+		if rec.Status == ReportPrinted {
+			attempts = nil
+			continue
+		}
+		if rec.Source == source && fiscalDate(rec.Time) == today {
+			attempts = append(attempts, rec)
+		}
+	}
+	return attempts
+}
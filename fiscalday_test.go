@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFiscalDayFailedAttempts(t *testing.T) {
+	day := time.Date(2025, 12, 1, 0, 0, 0, 0, time.Local)
+	at := func(hour int) time.Time { return day.Add(time.Duration(hour) * time.Hour) }
+	failed := func(hour int, source string) ReportRecord {
+		return ReportRecord{Time: at(hour), Source: source, Status: ReportFailed, Retryable: true}
+	}
+	printed := func(hour int, source string) ReportRecord {
+		return ReportRecord{Time: at(hour), Source: source, Status: ReportPrinted}
+	}
+
+	tests := []struct {
+		name    string
+		reports []ReportRecord
+		want    int
+	}{
+		{name: "bez prób", want: 0},
+		{
+			name:    "nieudane próby harmonogramu",
+			reports: []ReportRecord{failed(20, schedulerSource), failed(21, schedulerSource)},
+			want:    2,
+		},
+		{
+			name:    "udany raport zeruje licznik",
+			reports: []ReportRecord{failed(20, schedulerSource), printed(21, schedulerSource), failed(22, schedulerSource)},
+			want:    1,
+		},
+		{
+			name:    "udany raport ręczny zeruje licznik",
+			reports: []ReportRecord{failed(20, schedulerSource), printed(21, "cli")},
+			want:    0,
+		},
+		{
+			name:    "nieudane próby z innego źródła",
+			reports: []ReportRecord{failed(20, "cli")},
+			want:    0,
+		},
+		{
+			name:    "próby z poprzedniego dnia",
+			reports: []ReportRecord{failed(-2, schedulerSource)},
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := &FiscalDayLedger{Reports: tt.reports}
+			if got := ledger.FailedAttempts(schedulerSource, at(23)); len(got) != tt.want {
+				t.Errorf("próby = %d, oczekiwano %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerRetriesAfterSuccessfulReport(t *testing.T) {
+	queue, err := OpenJobQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 12, 1, 23, 0, 0, 0, time.Local)
+	ledger := &FiscalDayLedger{}
+	ledger.AddReport(ReportRecord{Time: now.Add(-2 * time.Hour), Source: schedulerSource, Status: ReportPrinted})
+	ledger.AddDocument(now.Add(-time.Hour))
+
+	out, _ := NewOutput(io.Discard, OutputHuman)
+	NewScheduler(SchedulerConfig{DailyReportAt: "21:00"}, queue, ledger, out).Check(now)
+
+	if n, _ := queue.Pending(); n != 1 {
+		t.Errorf("oczekujące zlecenia = %d, oczekiwano raportu dobowego", n)
+	}
+}
+
+func TestProcessSavesShiftAndFiscalDayAfterEachReceipt(t *testing.T) {
+	fc, _ := newFakePrinter(t, okReply)
+	s := newTestSession(t, fc, Product{Name: "Sweter", MinPrice: 100, MaxPrice: 100, Stock: 5})
+	s.cfg.Fiscal.ShippingChance = 0
+
+	if _, err := s.Process(Transaction{Date: "2025-12-01", Amount: 10000}, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	// rejestry zapisane od razu po wydruku, bez czekania na Save
+	day, err := LoadFiscalDay(s.paths.FiscalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if day.Documents != 1 {
+		t.Errorf("dokumenty dnia fiskalnego = %d, oczekiwano 1", day.Documents)
+	}
+	shift, err := LoadShift(s.paths.Shift)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shift.Receipts != 1 || shift.ReceiptsTotal != 10000 {
+		t.Errorf("zmiana: %d paragonów na %d, oczekiwano 1 na 10000", shift.Receipts, shift.ReceiptsTotal)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PrintForm drukuje wydruk niefiskalny SuperForm200. Linia "---" drukuje
+// separator, pusta linia odstęp, a linia zaczynająca się od "~" jest
+// drukowana małą czcionką.
+func (fc *FiscalClient) PrintForm(lines []string) error {
+	form, err := fc.Form200Start(-1, "")
+	if err != nil {
+		return fmt.Errorf("błąd formstart: %w", err)
+	}
+
+	for _, l := range lines {
+		switch {
+		case l == "---":
+			err = form.Cmd(1)
+		case strings.TrimSpace(l) == "":
+			err = form.Cmd(0)
+		case strings.HasPrefix(l, "~"):
+			err = form.TinyLine(strings.TrimSpace(l[1:]))
+		default:
+			err = form.FormattedLine(l, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := form.End(); err != nil {
+		return fmt.Errorf("błąd formend: %w", err)
+	}
+
+	return fc.drainResponses(1500 * time.Millisecond)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type Invoice struct {
+	Receipt
+	Number       string
+	BuyerName    string
+	BuyerAddress string
+	BuyerNIP     string
+	PaymentTerm  string
+	Copies       int
+}
+
+func (inv *Invoice) Validate() error {
+	if inv.Number == "" {
+		return fmt.Errorf("brak numeru faktury")
+	}
+	if inv.BuyerName == "" {
+		return fmt.Errorf("faktura %s: brak nazwy nabywcy", inv.Number)
+	}
+	if err := validateNIP(inv.BuyerNIP); err != nil {
+		return fmt.Errorf("faktura %s: %w", inv.Number, err)
+	}
+	if inv.Copies < 0 || inv.Copies > 9 {
+		return fmt.Errorf("faktura %s: nieprawidłowa liczba kopii: %d (dozwolone 0-9)", inv.Number, inv.Copies)
+	}
+	if err := inv.Receipt.Validate(); err != nil {
+		return fmt.Errorf("faktura %s: %w", inv.Number, err)
+	}
+	return nil
+}
+
+func normalizeNIP(nip string) string {
+	nip = strings.ToUpper(strings.TrimSpace(nip))
+	nip = strings.TrimPrefix(nip, "PL")
+	return strings.NewReplacer("-", "", " ", "").Replace(nip)
+}
+
+func validateNIP(nip string) error {
+	n := normalizeNIP(nip)
+	if len(n) != 10 {
+		return fmt.Errorf("nieprawidłowy NIP %q: wymagane 10 cyfr", nip)
+	}
+
+	weights := []int{6, 5, 7, 2, 3, 4, 5, 6, 7}
+	sum := 0
+	for i, r := range n {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("nieprawidłowy NIP %q: dozwolone tylko cyfry", nip)
+		}
+		if i < len(weights) {
+			sum += int(r-'0') * weights[i]
+		}
+	}
+	if sum%11 == 10 || sum%11 != int(n[9]-'0') {
+		return fmt.Errorf("nieprawidłowy NIP %q: błędna suma kontrolna", nip)
+	}
+	return nil
+}
+
+func (fc *FiscalClient) PrintInvoice(inv *Invoice) error {
+	if err := inv.Validate(); err != nil {
+		return &NotPrintedError{Err: err}
+	}
+
+	ctx := context.Background()
+
+	if err := fc.sendTrfvinit(inv); err != nil {
+		return &NotPrintedError{Err: fmt.Errorf("błąd trfvinit: %w", err)}
+	}
+	if err := fc.readResponse(ctx, "trfvinit"); err != nil {
+		return err
+	}
+
+	if err := fc.sendTrfvbuyer(inv); err != nil {
+		return fc.cancelTransaction(ctx, fmt.Errorf("błąd trfvbuyer: %w", err))
+	}
+	if err := fc.readResponse(ctx, "trfvbuyer"); err != nil {
+		return fc.cancelTransaction(ctx, err)
+	}
+
+	if err := fc.sendTransaction(ctx, &inv.Receipt); err != nil {
+		return fc.cancelTransaction(ctx, err)
+	}
+	return nil
+}
+
+func (fc *FiscalClient) sendTrfvinit(inv *Invoice) error {
+	numberBytes, err := encodeText(fc.enc, inv.Number)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	payload = append(payload, []byte("trfvinit")...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte("nb")...)
+	payload = append(payload, numberBytes...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte(fmt.Sprintf("cc%d", inv.Copies))...)
+	payload = append(payload, TAB)
+
+	if inv.PaymentTerm != "" {
+		termBytes, err := encodeText(fc.enc, inv.PaymentTerm)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, []byte("pt")...)
+		payload = append(payload, termBytes...)
+		payload = append(payload, TAB)
+	}
+
+	return fc.SendBytes(payload)
+}
+
+func (fc *FiscalClient) sendTrfvbuyer(inv *Invoice) error {
+	nameBytes, err := encodeText(fc.enc, inv.BuyerName)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	payload = append(payload, []byte("trfvbuyer")...)
+	payload = append(payload, TAB)
+
+	payload = append(payload, []byte("na")...)
+	payload = append(payload, nameBytes...)
+	payload = append(payload, TAB)
+
+	if inv.BuyerAddress != "" {
+		addrBytes, err := encodeText(fc.enc, inv.BuyerAddress)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, []byte("ad")...)
+		payload = append(payload, addrBytes...)
+		payload = append(payload, TAB)
+	}
+
+	payload = append(payload, []byte("ni"+normalizeNIP(inv.BuyerNIP))...)
+	payload = append(payload, TAB)
+
+	return fc.SendBytes(payload)
+}
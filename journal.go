@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type JournalDocument struct {
+	Number int      `json:"number"`
+	Date   string   `json:"date"`
+	Type   string   `json:"type"`
+	Lines  []string `json:"lines"`
+
+	// Transaction to transakcja, z której powstał dokument, jeśli drukował
+	// go ten program (rejestr dokumentów).
+	Transaction *DocumentRecord `json:"transaction,omitempty"`
+}
+
+// DocumentRecord wiąże dokument wydrukowany przez drukarkę (numer wydruku
+// z odpowiedzi na trend) z transakcją z pliku CSV.
+type DocumentRecord struct {
+	Number    int       `json:"number"`
+	Date      string    `json:"date"`
+	Document  string    `json:"document"`
+	OrderID   string    `json:"order_id,omitempty"`
+	Invoice   string    `json:"invoice,omitempty"`
+	Amount    int       `json:"amount"`
+	PrintedAt time.Time `json:"printed_at"`
+}
+
+type DocumentLedger struct {
+	Documents []DocumentRecord `json:"documents"`
+}
+
+func LoadDocuments(path string) (*DocumentLedger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &DocumentLedger{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu rejestru dokumentów: %w", err)
+	}
+
+	var ledger DocumentLedger
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON dokumentów: %w", err)
+	}
+	return &ledger, nil
+}
+
+func (l *DocumentLedger) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji JSON dokumentów: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru dokumentów: %w", err)
+	}
+
+	return nil
+}
+
+// Add zapisuje w rejestrze dokument o numerze wydruku number. Numer, który
+// nie jest liczbą, nie pozwoliłby odnaleźć dokumentu w kopii elektronicznej.
+func (l *DocumentLedger) Add(number string, r DocumentRecord) error {
+	n, err := strconv.Atoi(strings.TrimSpace(number))
+	if err != nil || n <= 0 {
+		return fmt.Errorf("nieprawidłowy numer wydruku %q", number)
+	}
+	r.Number = n
+	l.Documents = append(l.Documents, r)
+	return nil
+}
+
+// Find zwraca ostatni wpis dla numeru wydruku number albo nil.
+func (l *DocumentLedger) Find(number int) *DocumentRecord {
+	for i := len(l.Documents) - 1; i >= 0; i-- {
+		if l.Documents[i].Number == number {
+			return &l.Documents[i]
+		}
+	}
+	return nil
+}
+
+type JournalRange struct {
+	FromNumber int
+	ToNumber   int
+	FromDate   string
+	ToDate     string
+}
+
+func ParseJournalRange(s string) (JournalRange, error) {
+	s = strings.TrimSpace(s)
+	from, to, isRange := strings.Cut(s, "..")
+	from = strings.TrimSpace(from)
+	to = strings.TrimSpace(to)
+	if !isRange {
+		to = from
+	}
+
+	if isJournalDate(from) && isJournalDate(to) {
+		if from > to {
+			return JournalRange{}, fmt.Errorf("data początkowa %s jest późniejsza niż końcowa %s", from, to)
+		}
+		return JournalRange{FromDate: from, ToDate: to}, nil
+	}
+
+	fromNum, err := strconv.Atoi(from)
+	if err != nil || fromNum <= 0 {
+		return JournalRange{}, fmt.Errorf("nieprawidłowy zakres kopii elektronicznej: %q (użyj: NR, NR..NR lub YYYY-MM-DD..YYYY-MM-DD)", s)
+	}
+	toNum, err := strconv.Atoi(to)
+	if err != nil || toNum < fromNum {
+		return JournalRange{}, fmt.Errorf("nieprawidłowy zakres kopii elektronicznej: %q (użyj: NR, NR..NR lub YYYY-MM-DD..YYYY-MM-DD)", s)
+	}
+	return JournalRange{FromNumber: fromNum, ToNumber: toNum}, nil
+}
+
+func isJournalDate(s string) bool {
+	if len(s) != len("2006-01-02") {
+		return false
+	}
+	for i, r := range s {
+		if i == 4 || i == 7 {
+			if r != '-' {
+				return false
+			}
+			continue
+		}
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (fc *FiscalClient) JournalSearch(fromDate, toDate string) (int, int, error) {
+	var payload []byte
+	payload = append(payload, []byte("ejsearch")...)
+	payload = append(payload, TAB)
+	payload = append(payload, []byte("df"+fromDate)...)
+	payload = append(payload, TAB)
+	payload = append(payload, []byte("dt"+toDate)...)
+	payload = append(payload, TAB)
+
+	fields, err := fc.query(context.Background(), "ejsearch", payload)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	first, err := strconv.Atoi(fields["nf"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("nieprawidłowy numer pierwszego dokumentu: %q", fields["nf"])
+	}
+	last, err := strconv.Atoi(fields["nl"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("nieprawidłowy numer ostatniego dokumentu: %q", fields["nl"])
+	}
+	return first, last, nil
+}
+
+func (fc *FiscalClient) ReadJournalDocument(number int) (*JournalDocument, error) {
+	ctx := context.Background()
+
+	var payload []byte
+	payload = append(payload, []byte("ejdoc")...)
+	payload = append(payload, TAB)
+	payload = append(payload, []byte(fmt.Sprintf("nb%d", number))...)
+	payload = append(payload, TAB)
+
+	fields, err := fc.query(ctx, "ejdoc", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	lineCount, err := strconv.Atoi(fields["lc"])
+	if err != nil {
+		return nil, fmt.Errorf("dokument %d: nieprawidłowa liczba linii: %q", number, fields["lc"])
+	}
+
+	doc := &JournalDocument{
+		Number: number,
+		Date:   fields["da"],
+		Type:   fields["ty"],
+		Lines:  make([]string, 0, lineCount),
+	}
+
+	for i := 0; i < lineCount; i++ {
+		payload = payload[:0]
+		payload = append(payload, []byte("ejline")...)
+		payload = append(payload, TAB)
+		payload = append(payload, []byte(fmt.Sprintf("nb%d", number))...)
+		payload = append(payload, TAB)
+		payload = append(payload, []byte(fmt.Sprintf("ln%d", i))...)
+		payload = append(payload, TAB)
+
+		lineFields, err := fc.query(ctx, "ejline", payload)
+		if err != nil {
+			return nil, fmt.Errorf("dokument %d, linia %d: %w", number, i, err)
+		}
+
+		text, err := decodeText(fc.enc, []byte(lineFields["s1"]))
+		if err != nil {
+			return nil, fmt.Errorf("dokument %d, linia %d: %w", number, i, err)
+		}
+		doc.Lines = append(doc.Lines, text)
+	}
+
+	return doc, nil
+}
+
+func (fc *FiscalClient) ReadJournal(r JournalRange) ([]*JournalDocument, error) {
+	from, to := r.FromNumber, r.ToNumber
+	if r.FromDate != "" {
+		var err error
+		from, to, err = fc.JournalSearch(r.FromDate, r.ToDate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var docs []*JournalDocument
+	for n := from; n <= to && n > 0; n++ {
+		doc, err := fc.ReadJournalDocument(n)
+		if err != nil {
+			return docs, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (d *JournalDocument) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "=== Dokument nr %d", d.Number)
+	if d.Type != "" {
+		fmt.Fprintf(&sb, " (%s)", d.Type)
+	}
+	if d.Date != "" {
+		fmt.Fprintf(&sb, " %s", d.Date)
+	}
+	sb.WriteString(" ===\n")
+	if t := d.Transaction; t != nil {
+		fmt.Fprintf(&sb, "Transakcja: %s %s, %s zł", t.Document, t.Date, formatAmount(t.Amount))
+		if t.OrderID != "" {
+			fmt.Fprintf(&sb, ", zamówienie %s", t.OrderID)
+		}
+		if t.Invoice != "" {
+			fmt.Fprintf(&sb, ", faktura %s", t.Invoice)
+		}
+		sb.WriteByte('\n')
+	}
+	for _, line := range d.Lines {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// ExportJournal zapisuje dokumenty do plików ej_<numer>.<format>. Dokumenty
+// znalezione w rejestrze ledger dostają opis transakcji, a w nazwie pliku
+// również numer zamówienia. Bez force eksport dokumentu, który ma już plik
+// w katalogu dir, jest odrzucany przed zapisaniem czegokolwiek.
+func ExportJournal(docs []*JournalDocument, ledger *DocumentLedger, dir string, format string, force bool) ([]string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != "txt" && format != "json" {
+		return nil, fmt.Errorf("nieznany format eksportu: %q (użyj: txt|json)", format)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("błąd tworzenia katalogu %s: %w", dir, err)
+	}
+
+	paths := make([]string, len(docs))
+	for i, doc := range docs {
+		if ledger != nil {
+			doc.Transaction = ledger.Find(doc.Number)
+		}
+		name := fmt.Sprintf("ej_%06d", doc.Number)
+		if doc.Transaction != nil && doc.Transaction.OrderID != "" {
+			name += "_" + safeFileName(doc.Transaction.OrderID)
+		}
+		paths[i] = filepath.Join(dir, name+"."+format)
+
+		if force {
+			continue
+		}
+		existing, err := journalExports(dir, doc.Number, format)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("dokument %d wyeksportowano już do %s - użyj -force, aby nadpisać", doc.Number, existing[0])
+		}
+	}
+
+	var written []string
+	for i, doc := range docs {
+		var data []byte
+		if format == "json" {
+			var err error
+			data, err = json.MarshalIndent(doc, "", "  ")
+			if err != nil {
+				return written, fmt.Errorf("błąd serializacji dokumentu %d: %w", doc.Number, err)
+			}
+		} else {
+			data = []byte(doc.Text())
+		}
+
+		if err := writeFileAtomic(paths[i], data, 0); err != nil {
+			return written, fmt.Errorf("błąd zapisu %s: %w", paths[i], err)
+		}
+		written = append(written, paths[i])
+	}
+	return written, nil
+}
+
+// journalExports zwraca istniejące pliki eksportu dokumentu number, również
+// te z numerem zamówienia w nazwie.
+func journalExports(dir string, number int, format string) ([]string, error) {
+	name := fmt.Sprintf("ej_%06d", number)
+	var found []string
+	for _, pattern := range []string{name + "." + format, name + "_*." + format} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, matches...)
+	}
+	return found, nil
+}
+
+// safeFileName zastępuje znaki niedozwolone w nazwach plików podkreśleniem.
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
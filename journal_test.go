@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportJournalRefusesToOverwrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		force    bool
+		wantErr  string
+	}{
+		{name: "nowy eksport"},
+		{name: "istniejący plik", existing: "ej_000125.txt", wantErr: "użyj -force"},
+		{name: "istniejący plik z numerem zamówienia", existing: "ej_000125_ZAM-12.txt", wantErr: "ej_000125_ZAM-12.txt"},
+		{name: "plik w innym formacie", existing: "ej_000125.json"},
+		{name: "inny dokument", existing: "ej_001250.txt"},
+		{name: "nadpisanie z -force", existing: "ej_000125.txt", force: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.existing != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.existing), []byte("stary"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			docs := []*JournalDocument{
+				{Number: 124, Type: "paragon", Lines: []string{"PARAGON FISKALNY"}},
+				{Number: 125, Type: "paragon", Lines: []string{"PARAGON FISKALNY"}},
+			}
+
+			files, err := ExportJournal(docs, nil, dir, "txt", tt.force)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				// odmowa przed zapisem - żaden dokument nie został wyeksportowany
+				if _, err := os.Stat(filepath.Join(dir, "ej_000124.txt")); !os.IsNotExist(err) {
+					t.Errorf("zapisano ej_000124.txt mimo odmowy: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nieoczekiwany błąd: %v", err)
+			}
+			if len(files) != len(docs) {
+				t.Fatalf("pliki = %v, oczekiwano %d", files, len(docs))
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "ej_000125.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "PARAGON FISKALNY") {
+				t.Errorf("treść = %q, oczekiwano nowego eksportu", data)
+			}
+		})
+	}
+}
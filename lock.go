@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockedError oznacza, że blokadę trzyma inny działający proces.
+// Resource opisuje zablokowany zasób; domyślnie jest nim drukarka.
+type LockedError struct {
+	Path     string
+	PID      int
+	Resource string
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("blokada %s jest właśnie zakładana przez inny proces", e.Path)
+	}
+	if e.Resource != "" {
+		return fmt.Sprintf("%s przez proces %d (blokada %s)", e.Resource, e.PID, e.Path)
+	}
+	return fmt.Sprintf("drukarka zajęta przez proces %d (blokada %s)", e.PID, e.Path)
+}
+
+// FileLock to blokada międzyprocesowa założona przez system operacyjny
+// (flock, na Windows LockFileEx) na otwartym pliku. System zwalnia ją sam,
+// gdy proces się zakończy, także po awarii. Plik zawiera PID właściciela
+// tylko na potrzeby komunikatu dla innych procesów.
+type FileLock struct {
+	path string
+	f    *os.File
+}
+
+// errLockBusy zwraca lockFile, gdy blokadę trzyma inny proces.
+var errLockBusy = errors.New("blokada zajęta")
+
+func AcquireLock(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("błąd zakładania blokady %s: %w", path, err)
+	}
+	if err := lockFile(f); err != nil {
+		pid := readLockPID(f)
+		f.Close()
+		if errors.Is(err, errLockBusy) {
+			return nil, &LockedError{Path: path, PID: pid}
+		}
+		return nil, fmt.Errorf("błąd zakładania blokady %s: %w", path, err)
+	}
+
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, fmt.Errorf("błąd zapisu blokady %s: %w", path, err)
+	}
+	return &FileLock{path: path, f: f}, nil
+}
+
+// WaitLock zakłada blokadę path, czekając najwyżej timeout, aż zwolni ją
+// inny proces. Służy do krótkich sekcji krytycznych, np. zmiany salda bonu.
+func WaitLock(path string, timeout time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := AcquireLock(path)
+		var locked *LockedError
+		if !errors.As(err, &locked) || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// readLockPID odczytuje PID właściciela blokady; 0 oznacza, że właściciel
+// jeszcze go nie zapisał.
+func readLockPID(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	return pid
+}
+
+// Release zwalnia blokadę; nic nie robi dla nil. Plik blokady zostaje na
+// dysku: usunięcie go pozwoliłoby innemu procesowi zablokować nowy plik,
+// podczas gdy trzeci proces trzyma jeszcze blokadę starego.
+func (l *FileLock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	l.f.Truncate(0)
+	unlockFile(l.f)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
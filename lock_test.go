@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printer.lock")
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = AcquireLock(path)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("błąd = %v, oczekiwano *LockedError", err)
+	}
+	if locked.PID != os.Getpid() {
+		t.Errorf("PID właściciela = %d, oczekiwano %d", locked.PID, os.Getpid())
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("ponowne zwolnienie: %v", err)
+	}
+	lock, err = AcquireLock(path)
+	if err != nil {
+		t.Fatalf("blokada po zwolnieniu: %v", err)
+	}
+	lock.Release()
+}
+
+func TestAcquireLockIgnoresLeftoverPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printer.lock")
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("plik bez blokady systemowej: %v", err)
+	}
+	lock.Release()
+}
+
+func TestWaitLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vouchers.json.lock")
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { lock.Release() })
+
+	second, err := WaitLock(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("oczekiwanie na blokadę: %v", err)
+	}
+	second.Release()
+}
+
+// TestLockHelperProcess zakłada blokadę w osobnym procesie dla
+// TestLockReleasedWhenProcessDies; zwykłe uruchomienie testów go pomija.
+func TestLockHelperProcess(t *testing.T) {
+	path := os.Getenv("POSNET_TEST_LOCK")
+	if path == "" {
+		t.Skip("proces pomocniczy")
+	}
+	if _, err := AcquireLock(path); err != nil {
+		os.Exit(1)
+	}
+	os.Stdout.WriteString("ok\n")
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func TestLockReleasedWhenProcessDies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printer.lock")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), "POSNET_TEST_LOCK="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "ok\n" {
+		cmd.Process.Kill()
+		t.Fatalf("proces pomocniczy nie założył blokady: %q, %v", line, err)
+	}
+
+	_, err = AcquireLock(path)
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.PID != cmd.Process.Pid {
+		t.Errorf("błąd = %v, oczekiwano blokady procesu %d", err, cmd.Process.Pid)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("blokada po awarii właściciela: %v", err)
+	}
+	lock.Release()
+}
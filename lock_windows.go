@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// lockRange zwraca zakres blokady: jeden bajt daleko za końcem pliku.
+// Blokady zakresów na Windows są obowiązkowe, więc blokada treści pliku
+// uniemożliwiłaby innym procesom odczyt PID właściciela.
+func lockRange() *syscall.Overlapped {
+	return &syscall.Overlapped{OffsetHigh: 0x7fffffff}
+}
+
+func lockFile(f *os.File) error {
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(lockRange())))
+	if r != 0 {
+		return nil
+	}
+	if err == errorLockViolation || err == syscall.ERROR_IO_PENDING {
+		return errLockBusy
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(lockRange())))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
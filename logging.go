@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+
+	defaultLogMaxSizeKB = 1024
+	defaultLogMaxFiles  = 5
+)
+
+type LogConfig struct {
+	Level     string `json:"level"`
+	Format    string `json:"format"`
+	Output    string `json:"output"`
+	File      string `json:"file,omitempty"`
+	MaxSizeKB int    `json:"max_size_kb,omitempty"`
+	MaxFiles  int    `json:"max_files,omitempty"`
+}
+
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("nieprawidłowy poziom logowania: %q (dozwolone: debug|info|warn|error)", s)
+}
+
+func (l LogConfig) validate(e *ConfigError) {
+	if _, err := parseLogLevel(l.Level); err != nil {
+		e.add("log.level", "%v", err)
+	}
+	switch l.Format {
+	case "", "text", "json":
+	default:
+		e.add("log.format", "nieprawidłowy format logów: %q (dozwolone: text|json)", l.Format)
+	}
+	switch l.Output {
+	case "", LogOutputStderr:
+	case LogOutputFile:
+		if l.File == "" {
+			e.add("log.file", "brak ścieżki pliku logów dla output: file")
+		}
+	default:
+		e.add("log.output", "nieprawidłowe wyjście logów: %q (dozwolone: stderr|file)", l.Output)
+	}
+	if l.MaxSizeKB < 0 {
+		e.add("log.max_size_kb", "rozmiar pliku logów nie może być ujemny: %d", l.MaxSizeKB)
+	}
+	if l.MaxFiles < 0 {
+		e.add("log.max_files", "liczba plików logów nie może być ujemna: %d", l.MaxFiles)
+	}
+}
+
+// NewLogger tworzy logger według konfiguracji; zwrócony Closer zamyka plik
+// logów (dla stderr nic nie robi).
+func NewLogger(cfg LogConfig) (*slog.Logger, io.Closer, error) {
+	level, err := parseLogLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var w io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.Output == LogOutputFile {
+		maxSize := cfg.MaxSizeKB
+		if maxSize == 0 {
+			maxSize = defaultLogMaxSizeKB
+		}
+		maxFiles := cfg.MaxFiles
+		if maxFiles == 0 {
+			maxFiles = defaultLogMaxFiles
+		}
+		w, err = openRotatingFile(cfg.File, int64(maxSize)*1024, maxFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if cfg.Format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(h), w, nil
+}
+
+var logCloser io.Closer = nopCloser{}
+
+// setupLogging ustawia domyślny logger programu według konfiguracji.
+func setupLogging(cfg LogConfig) error {
+	logger, closer, err := NewLogger(cfg)
+	if err != nil {
+		return err
+	}
+	logCloser.Close()
+	logCloser = closer
+	slog.SetDefault(logger)
+	return nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// rotatingFile to plik logów rotowany po przekroczeniu maxSize:
+// plik.log -> plik.log.1 -> ... -> plik.log.N (najstarszy jest usuwany).
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("błąd otwarcia pliku logów: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("błąd otwarcia pliku logów: %w", err)
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, fmt.Errorf("błąd rotacji pliku logów: %w", err)
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// payloadAttrs opisuje ramkę w logu: nazwa polecenia, długość, CRC oraz
+// treść w postaci hex i zdekodowanej w kodowaniu drukarki.
+func payloadAttrs(enc Encoding, payload []byte) []any {
+	cmd := string(payload)
+	if i := strings.IndexByte(cmd, TAB); i >= 0 {
+		cmd = cmd[:i]
+	}
+	text, err := decodeText(enc, payload)
+	if err != nil {
+		text = string(payload)
+	}
+	return []any{
+		slog.String("command", cmd),
+		slog.Int("bytes", len(payload)),
+		slog.String("crc", fmt.Sprintf("%04X", crc16CCITT(payload))),
+		slog.String("hex", hex.EncodeToString(payload)),
+		slog.String("text", sanitizeASCII(text)),
+	}
+}
@@ -2,313 +2,417 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
-	"strings"
+	"path/filepath"
 	"time"
 )
 
-func main() {
-	var (
-		configPath    = flag.String("config", "config.json", "Ścieżka do pliku konfiguracji")
-		dataPath      = flag.String("data", "data.json", "Ścieżka do pliku danych (produkty)")
-		csvPath       = flag.String("csv", "", "Ścieżka do pliku CSV (np. reports/01.csv) lub katalogu z plikami CSV")
-		createCfg     = flag.Bool("create-config", false, "Utwórz przykładowy plik konfiguracji i zakończ")
-		dryRun        = flag.Bool("dry-run", false, "Tryb testowy - nie łącz się z drukarką, tylko wyświetl co zostałoby wydrukowane")
-		dailyReport          = flag.String("daily-report", "", "Wydrukuj raport dobowy (zawsze dla bieżącego dnia)")
-		monthlyReport        = flag.String("monthly-report", "", "Wydrukuj raport miesięczny dla podanej daty (format: YYYY-MM-DD, brana pod uwagę tylko miesiąc i rok) lub puste dla bieżącego miesiąca")
-		monthlyReportSummary = flag.Bool("monthly-report-summary", false, "Raport miesięczny w wersji skróconej (podsumowanie)")
-	)
-	flag.Parse()
-
-	if *createCfg {
-		cfg := CreateExampleConfig()
-		if err := cfg.SaveConfig(*configPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd zapisu przykładowej konfiguracji: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("✓ Utworzono przykładową konfigurację: %s\n", *configPath)
+const programName = "posnet-printer"
 
-		data := CreateExampleData()
-		if err := data.SaveData(*dataPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd zapisu przykładowych danych: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("✓ Utworzono przykładowe dane produktów: %s\n", *dataPath)
-		fmt.Println("Edytuj pliki i dostosuj ustawienia przed użyciem.")
-		return
-	}
+// Kody wyjścia wspólne dla wszystkich poleceń.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
 
-	if *dailyReport != "" || *monthlyReport != "" {
-		fmt.Printf("→ Wczytuję konfigurację z %s...\n", *configPath)
-		cfg, err := LoadConfig(*configPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd wczytywania konfiguracji: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Println("✓ Konfiguracja wczytana")
-
-		if *dryRun {
-			fmt.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
-			if *dailyReport != "" {
-				fmt.Println("✓ [SYMULACJA] Raport dobowy")
-			}
-			if *monthlyReport != "" {
-				fmt.Println("✓ [SYMULACJA] Raport miesięczny")
-			}
-			return
-		}
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+	sub     []command
+}
 
-		fmt.Printf("→ Łączę z drukarką %s:%d...\n", cfg.Printer.Host, cfg.Printer.Port)
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "print", summary: "Drukuj paragony z pliku CSV lub katalogu", run: runPrint},
+		{name: "report", summary: "Raporty fiskalne", sub: []command{
+			{name: "daily", summary: "Wydrukuj raport dobowy", run: runReportDaily},
+			{name: "monthly", summary: "Wydrukuj raport miesięczny", run: runReportMonthly},
+		}},
+		{name: "status", summary: "Pokaż stan drukarki", run: runStatus},
+		{name: "config", summary: "Zarządzanie konfiguracją", sub: []command{
+			{name: "init", summary: "Utwórz przykładową konfigurację i dane produktów", run: runConfigInit},
+			{name: "validate", summary: "Sprawdź konfigurację i wypisz wszystkie błędy", run: runConfigValidate},
+			{name: "migrate", summary: "Zapisz konfigurację i dane produktów w bieżącej wersji", run: runConfigMigrate},
+			{name: "show", summary: "Pokaż konfigurację (z -effective po złożeniu wszystkich warstw)", run: runConfigShow},
+		}},
+		{name: "stock", summary: "Pokaż stan magazynowy", run: runStock},
+		{name: "journal", summary: "Odczytaj i wyeksportuj kopię elektroniczną", run: runJournal},
+		{name: "form", summary: "Wydrukuj wydruk niefiskalny", run: runForm},
+		{name: "drawer", summary: "Otwórz szufladę kasową", run: runDrawer},
+		{name: "cash", summary: "Operacje kasowe", sub: []command{
+			{name: "in", summary: "Zarejestruj wpłatę do kasy", run: runCashIn},
+			{name: "out", summary: "Zarejestruj wypłatę z kasy", run: runCashOut},
+		}},
+		{name: "shift", summary: "Zmiana kasjera", sub: []command{
+			{name: "report", summary: "Wydrukuj raport zmiany i rozpocznij nową zmianę", run: runShiftReport},
+		}},
+		{name: "voucher", summary: "Rejestr bonów", sub: []command{
+			{name: "issue", summary: "Dodaj bon do rejestru", run: runVoucherIssue},
+		}},
+		{name: "capture", summary: "Nagrania ruchu protokołu", sub: []command{
+			{name: "show", summary: "Wyświetl zdekodowane ramki nagrania", run: runCaptureShow},
+		}},
+		{name: "replay", summary: "Odtwórz nagranie na emulatorze drukarki", run: runReplay},
+		{name: "serve", summary: "Udostępnij drukarkę przez lokalne API HTTP/JSON", run: runServe},
+		{name: "watch", summary: "Drukuj pliki CSV pojawiające się w katalogu", run: runWatch},
+		{name: "daemon", summary: "Drukuj raport dobowy według harmonogramu i wykonuj kolejkę", run: runDaemon},
+		{name: "queue", summary: "Kolejka zleceń drukarki", sub: []command{
+			{name: "list", summary: "Pokaż zlecenia w kolejce", run: runQueueList},
+			{name: "run", summary: "Wykonaj oczekujące zlecenia", run: runQueueRun},
+		}},
+	}
+}
 
-		enc, err := parseEncoding(cfg.Encoding)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd parsowania encoding: %v\n", err)
-			os.Exit(1)
-		}
+func main() {
+	code := dispatch(programName, commands, os.Args[1:])
+	releaseLocks()
+	logCloser.Close()
+	os.Exit(code)
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Printer.Timeout)*time.Second)
-		defer cancel()
+func dispatch(prefix string, cmds []command, args []string) int {
+	if len(args) == 0 {
+		printCommands(os.Stderr, prefix, cmds)
+		return exitUsage
+	}
 
-		client, err := Dial(ctx, fmt.Sprintf("%s:%d", cfg.Printer.Host, cfg.Printer.Port),
-			enc, time.Duration(cfg.Printer.Timeout)*time.Second,
-			cfg.Printer.LogTX, cfg.Printer.LogRX)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd połączenia z drukarką: %v\n", err)
-			os.Exit(1)
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		printCommands(os.Stdout, prefix, cmds)
+		return exitOK
+	}
+
+	for _, c := range cmds {
+		if c.name != name {
+			continue
 		}
-		defer client.Close()
-
-		fc := NewFiscalClient(client, cfg.Fiscal.VATRate, cfg.Fiscal.PaymentType)
-		fmt.Println("✓ Połączono z drukarką")
-
-		if *dailyReport != "" {
-			fmt.Println("→ Drukuję raport dobowy...")
-			if err := fc.DailyReport(""); err != nil {
-				fmt.Fprintf(os.Stderr, "❌ BŁĄD RAPORTU DOBOWEGO: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Println("✓ Raport dobowy wydrukowany")
+		if c.sub != nil {
+			return dispatch(prefix+" "+c.name, c.sub, args[1:])
 		}
+		return c.run(args[1:])
+	}
 
-		if *monthlyReport != "" {
-			reportType := "pełny"
-			if *monthlyReportSummary {
-				reportType = "skrócony"
-			}
-			fmt.Printf("→ Drukuję raport miesięczny (%s)...\n", reportType)
-			if err := fc.MonthlyReport(*monthlyReport, *monthlyReportSummary); err != nil {
-				fmt.Fprintf(os.Stderr, "❌ BŁĄD RAPORTU MIESIĘCZNEGO: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Println("✓ Raport miesięczny wydrukowany")
-		}
+	fmt.Fprintf(os.Stderr, "Błąd: nieznane polecenie %q\n\n", name)
+	printCommands(os.Stderr, prefix, cmds)
+	return exitUsage
+}
 
-		return
+func printCommands(w io.Writer, prefix string, cmds []command) {
+	fmt.Fprintf(w, "Użycie: %s <polecenie> [opcje]\n\nPolecenia:\n", prefix)
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintf(w, "\nSzczegóły: %s <polecenie> -h\n", prefix)
+}
 
-	if *csvPath == "" {
-		fmt.Fprintln(os.Stderr, "Błąd: wymagany parametr -csv")
-		fmt.Fprintln(os.Stderr, "Użycie: druk -csv reports/01.csv [-config config.json]")
-		fmt.Fprintln(os.Stderr, "lub: druk -create-config [-config config.json]")
-		fmt.Fprintln(os.Stderr, "lub: druk -daily-report [YYYY-MM-DD] [-config config.json]")
-		fmt.Fprintln(os.Stderr, "lub: druk -monthly-report [-config config.json]")
-		os.Exit(1)
+// newFlagSet tworzy zestaw opcji polecenia; usage to składnia argumentów
+// pozycyjnych wyświetlana w pomocy.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Użycie: %s %s [opcje]", programName, name)
+		if usage != "" {
+			fmt.Fprintf(fs.Output(), " %s", usage)
+		}
+		fmt.Fprint(fs.Output(), "\n\nOpcje:\n")
+		fs.PrintDefaults()
 	}
+	fs.String("output", OutputHuman, "Format wyjścia: human|json (jedno zdarzenie JSON na linię)")
+	return fs
+}
 
-	fmt.Printf("→ Wczytuję konfigurację z %s...\n", *configPath)
-	cfg, err := LoadConfig(*configPath)
+// parseFlags zwraca false razem z kodem wyjścia, jeśli polecenie ma się
+// zakończyć (wyświetlona pomoc lub błędne opcje).
+func parseFlags(fs *flag.FlagSet, args []string) (*Output, int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, exitOK, false
+		}
+		return nil, exitUsage, false
+	}
+	o, err := NewOutput(os.Stdout, fs.Lookup("output").Value.String())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Błąd wczytywania konfiguracji: %v\n", err)
-		os.Exit(1)
+		return nil, usageError(fs, "%v", err), false
 	}
-	fmt.Println("✓ Konfiguracja wczytana")
+	return o, exitOK, true
+}
 
-	fmt.Printf("→ Wczytuję dane produktów z %s...\n", *dataPath)
-	dataConfig, err := LoadData(*dataPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Błąd wczytywania danych: %v\n", err)
-		os.Exit(1)
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "Błąd: "+format+"\n\n", args...)
+	fs.Usage()
+	return exitUsage
+}
+
+// fail wypisuje błąd na stderr (w trybie json również jako zdarzenie
+// error) i zwraca kod wyjścia.
+func fail(o *Output, format string, args ...interface{}) int {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintln(os.Stderr, msg)
+	o.Event("error", MessageEvent{Message: msg})
+	return exitFailure
+}
+
+// configFlags to ścieżka konfiguracji, wybrany profil drukarki i ustawienia
+// nadpisane flagami.
+type configFlags struct {
+	path      string
+	printer   string
+	overrides []ConfigOverride
+}
+
+func configFlag(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	fs.StringVar(&cf.path, "config", "config.json", "Ścieżka do pliku konfiguracji")
+	fs.StringVar(&cf.printer, "printer", "", "Nazwa drukarki z sekcji printers (domyślnie sekcja printer)")
+	override := func(name, path, usage string) {
+		fs.Func(name, usage, func(value string) error {
+			cf.overrides = append(cf.overrides, ConfigOverride{Path: path, Value: value, Source: "flag -" + name})
+			return nil
+		})
 	}
-	fmt.Println("✓ Dane produktów wczytane")
+	override("host", "printer.host", "Adres IP drukarki (nadpisuje konfigurację)")
+	override("port", "printer.port", "Port drukarki (nadpisuje konfigurację)")
+	override("timeout", "printer.timeout", "Timeout połączenia z drukarką w sekundach (nadpisuje konfigurację)")
+	override("encoding", "encoding", "Kodowanie drukarki (nadpisuje konfigurację)")
+	return cf
+}
+
+func dataFlag(fs *flag.FlagSet) *string {
+	return fs.String("data", "data.json", "Ścieżka do pliku danych (produkty)")
+}
+
+func ledgerFlags(fs *flag.FlagSet, paths *SessionPaths) {
+	fs.StringVar(&paths.Shift, "shift", paths.Shift, "Ścieżka do pliku bieżącej zmiany")
+	fs.StringVar(&paths.Returns, "returns", paths.Returns, "Ścieżka do rejestru zwrotów")
+	fs.StringVar(&paths.Advances, "advances", paths.Advances, "Ścieżka do rejestru otwartych zaliczek")
+	fs.StringVar(&paths.Vouchers, "vouchers", paths.Vouchers, "Ścieżka do rejestru bonów i kart podarunkowych")
+	fiscalDayFlag(fs, &paths.FiscalDay)
+	documentsFlag(fs, &paths.Documents)
+}
+
+func fiscalDayFlag(fs *flag.FlagSet, path *string) {
+	fs.StringVar(path, "fiscal-day", DefaultSessionPaths().FiscalDay, "Ścieżka do rejestru dnia fiskalnego (dokumenty i raporty dobowe)")
+}
+
+func documentsFlag(fs *flag.FlagSet, path *string) {
+	fs.StringVar(path, "documents", DefaultSessionPaths().Documents, "Ścieżka do rejestru dokumentów (numery wydruków transakcji z CSV)")
+}
 
-	fmt.Printf("→ Wczytuję transakcje z %s...\n", *csvPath)
-	var transactions []Transaction
+func dryRunFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("dry-run", false, "Tryb testowy - nie łącz się z drukarką, tylko wyświetl co zostałoby wydrukowane")
+}
 
-	info, err := os.Stat(*csvPath)
+func loadConfig(o *Output, cf *configFlags) (*Config, error) {
+	o.Printf("→ Wczytuję konfigurację z %s...\n", cf.path)
+	cfg, err := LoadLayeredConfig(cf.path, cf.printer, cf.overrides)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Błąd dostępu do %s: %v\n", *csvPath, err)
-		os.Exit(1)
+		return nil, fmt.Errorf("błąd wczytywania konfiguracji: %w", err)
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		return nil, fmt.Errorf("błąd konfiguracji logowania: %w", err)
+	}
+	if err := prepareProfile(o, cfg); err != nil {
+		return nil, err
 	}
+	warnMigrated(o, cfg.migrated)
+	o.Println("✓ Konfiguracja wczytana")
+	return cfg, nil
+}
 
-	if info.IsDir() {
-		transactions, err = ParseCSVDirectory(*csvPath)
-	} else {
-		transactions, err = ParseCSVFile(*csvPath)
+// warnMigrated informuje, że plik w starszej wersji został podniesiony tylko
+// w pamięci.
+func warnMigrated(o *Output, res *MigrationResult) {
+	if !res.Upgraded() {
+		return
 	}
+	o.Warn("plik %s jest w wersji %d, wczytano go po migracji do wersji %d - zapisz go poleceniem config migrate",
+		res.File, res.From, res.To)
+}
 
+// loadData blokuje plik danych produktów do końca działania programu
+// i wczytuje go.
+func loadData(o *Output, path string) (*DataConfig, error) {
+	o.Printf("→ Wczytuję dane produktów z %s...\n", path)
+	if err := lockData(path); err != nil {
+		return nil, err
+	}
+	data, err := LoadData(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Błąd parsowania CSV: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("błąd wczytywania danych: %w", err)
 	}
+	warnMigrated(o, data.migrated)
+	o.Println("✓ Dane produktów wczytane")
+	return data, nil
+}
 
-	if len(transactions) == 0 {
-		fmt.Fprintln(os.Stderr, "Błąd: brak transakcji w plikach CSV")
-		os.Exit(1)
+// useProfile przełącza konfigurację na drukarkę name.
+func useProfile(o *Output, cfg *Config, name string) (*Config, error) {
+	cfg, err := cfg.ForPrinter(name)
+	if err != nil {
+		return nil, err
 	}
+	if err := prepareProfile(o, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	fmt.Printf("✓ Wczytano %d transakcji\n", len(transactions))
+// prepareProfile tworzy katalog rejestrów wybranego profilu drukarki.
+func prepareProfile(o *Output, cfg *Config) error {
+	if cfg.StateDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(cfg.StateDir, 0755); err != nil {
+		return fmt.Errorf("błąd tworzenia katalogu drukarki %s: %w", cfg.Profile, err)
+	}
+	o.Printf("✓ Drukarka %s (%s:%d, rejestry w %s)\n", cfg.Profile, cfg.Printer.Host, cfg.Printer.Port, cfg.StateDir)
+	return nil
+}
 
-	grouped := GroupByDate(transactions)
-	dates := GetUniqueDates(transactions)
-	fmt.Printf("✓ Znaleziono %d unikalnych dni\n", len(dates))
+// flagGiven zwraca true, gdy flagę name podano w wierszu poleceń.
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
 
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+// profileFile umieszcza plik rejestru w katalogu profilu drukarki, o ile
+// jego ścieżki nie podano jawnie flagą name.
+func profileFile(fs *flag.FlagSet, cfg *Config, name, path string) string {
+	if cfg.StateDir == "" || flagGiven(fs, name) {
+		return path
+	}
+	return filepath.Join(cfg.StateDir, path)
+}
 
-	var fc *FiscalClient
-	if !*dryRun {
-		fmt.Printf("→ Łączę z drukarką %s:%d...\n", cfg.Printer.Host, cfg.Printer.Port)
+// profileData zwraca plik produktów z profilu drukarki, jeśli nie podano
+// -data.
+func profileData(fs *flag.FlagSet, cfg *Config, path string) string {
+	if cfg.DataPath == "" || flagGiven(fs, "data") {
+		return path
+	}
+	return cfg.DataPath
+}
 
-		enc, err := parseEncoding(cfg.Encoding)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd parsowania encoding: %v\n", err)
-			os.Exit(1)
-		}
+// profilePaths dostosowuje ścieżki sesji do profilu drukarki: rejestry trafiają
+// do jej katalogu, a plik produktów jest brany z profilu (zob. profileData).
+func profilePaths(fs *flag.FlagSet, cfg *Config, paths SessionPaths) SessionPaths {
+	paths.Data = profileData(fs, cfg, paths.Data)
+	paths.Shift = profileFile(fs, cfg, "shift", paths.Shift)
+	paths.Returns = profileFile(fs, cfg, "returns", paths.Returns)
+	paths.Advances = profileFile(fs, cfg, "advances", paths.Advances)
+	paths.Vouchers = profileFile(fs, cfg, "vouchers", paths.Vouchers)
+	paths.FiscalDay = profileFile(fs, cfg, "fiscal-day", paths.FiscalDay)
+	paths.Documents = profileFile(fs, cfg, "documents", paths.Documents)
+	return paths
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Printer.Timeout)*time.Second)
-		defer cancel()
+// heldLocks to blokady (po ścieżce pliku blokady) trzymane do końca
+// działania programu, aby inne procesy nie korzystały w tym samym czasie
+// z drukarki lub pliku danych.
+var heldLocks = make(map[string]*FileLock)
 
-		client, err := Dial(ctx, fmt.Sprintf("%s:%d", cfg.Printer.Host, cfg.Printer.Port),
-			enc, time.Duration(cfg.Printer.Timeout)*time.Second,
-			cfg.Printer.LogTX, cfg.Printer.LogRX)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Błąd połączenia z drukarką: %v\n", err)
-			os.Exit(1)
-		}
-		defer client.Close()
-
-		fc = NewFiscalClient(client, cfg.Fiscal.VATRate, cfg.Fiscal.PaymentType)
-		fmt.Println("✓ Połączono z drukarką")
-	} else {
-		fmt.Println("⚠ TRYB TESTOWY - symulacja bez drukarki")
-	}
-
-	totalReceipts := 0
-	totalErrors := 0
-
-	for _, date := range dates {
-		dayTransactions := grouped[date]
-		fmt.Printf("\n═══════════════════════════════════════\n")
-		fmt.Printf("📅 Data: %s (%d paragonów)\n", date, len(dayTransactions))
-		fmt.Printf("═══════════════════════════════════════\n")
-
-		selector := NewProductSelector(cfg, dataConfig, rnd)
-
-		for i, trans := range dayTransactions {
-			receiptNum := i + 1
-			fmt.Printf("\n[%d/%d] Paragon %.2f zł... ", receiptNum, len(dayTransactions), float64(trans.Amount)/100.0)
-
-			products, err := selector.SelectProducts(trans.Amount)
-			if err != nil {
-				fmt.Printf("❌ BŁĄD: %v\n", err)
-				totalErrors++
-				continue
-			}
-
-			receipt := &Receipt{
-				Total: trans.Amount,
-			}
-
-			for _, p := range products {
-				receipt.Lines = append(receipt.Lines, ReceiptLine{
-					Name:     p.Name,
-					Price:    p.Price,
-					Quantity: 1.0,
-					VATRate:  cfg.Fiscal.VATRate,
-				})
-			}
-
-			fmt.Println("✓")
-			for _, line := range receipt.Lines {
-				fmt.Printf("  • %s: %.2f zł\n", line.Name, float64(line.Price)/100.0)
-			}
-
-			if !*dryRun {
-				if err := fc.PrintReceipt(receipt); err != nil {
-					fmt.Printf("  ❌ BŁĄD DRUKOWANIA: %v\n", err)
-					totalErrors++
-					continue
-				}
-			}
-
-			if err := selector.DecrementStockPermanent(products); err != nil {
-				fmt.Printf("  ⚠ OSTRZEŻENIE: błąd aktualizacji stanu: %v\n", err)
-			}
-
-			totalReceipts++
-
-			if !*dryRun {
-				time.Sleep(500 * time.Millisecond)
-			}
-		}
+// holdLock zakłada blokadę path do końca działania programu; ponowne
+// wywołanie dla tej samej ścieżki nic nie robi.
+func holdLock(path string) error {
+	if heldLocks[path] != nil {
+		return nil
+	}
+	lock, err := AcquireLock(path)
+	if err != nil {
+		return err
+	}
+	heldLocks[path] = lock
+	return nil
+}
 
-		fmt.Print("\n→ Czy wydrukować raport dobowy? [t/N]: ")
-
-		var printReport bool
-		if !*dryRun {
-			var response string
-			fmt.Scanln(&response)
-			response = strings.ToLower(strings.TrimSpace(response))
-			printReport = (response == "t" || response == "tak" || response == "y" || response == "yes")
-
-			if printReport {
-				fmt.Println("→ Drukuję raport dobowy...")
-				if err := fc.DailyReport(""); err != nil {
-					fmt.Printf("❌ BŁĄD RAPORTU DOBOWEGO: %v\n", err)
-					totalErrors++
-				} else {
-					fmt.Println("✓ Raport dobowy wydrukowany")
-				}
-				time.Sleep(2 * time.Second)
-			} else {
-				fmt.Println("⊘ Pominięto raport dobowy")
-			}
-		} else {
-			fmt.Println("\n✓ [SYMULACJA] Raport dobowy (pominięty w trybie testowym)")
-		}
+func releaseLocks() {
+	for path, lock := range heldLocks {
+		lock.Release()
+		delete(heldLocks, path)
+	}
+}
+
+func lockPrinter(cfg *Config) error {
+	dir := cfg.Printer.QueuePath()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("błąd tworzenia katalogu kolejki: %w", err)
 	}
+	return holdLock(filepath.Join(dir, "printer.lock"))
+}
 
-	fmt.Printf("\n→ Zapisuję zaktualizowany stan magazynowy...\n")
-	if err := dataConfig.SaveData(*dataPath); err != nil {
-		fmt.Printf("⚠ OSTRZEŻENIE: nie udało się zapisać stanu: %v\n", err)
-	} else {
-		fmt.Println("✓ Stan magazynowy zapisany")
+// lockData zakłada blokadę pliku danych produktów, aby dwa procesy nie
+// nadpisywały sobie nawzajem stanów magazynowych.
+func lockData(path string) error {
+	err := holdLock(path + ".lock")
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		locked.Resource = fmt.Sprintf("plik %s jest używany", path)
 	}
+	return err
+}
 
-	fmt.Printf("\n═══════════════════════════════════════\n")
-	fmt.Printf("📊 PODSUMOWANIE\n")
-	fmt.Printf("═══════════════════════════════════════\n")
-	fmt.Printf("Wydrukowanych paragonów: %d\n", totalReceipts)
-	fmt.Printf("Błędów: %d\n", totalErrors)
-	fmt.Printf("Dni przetworzonych: %d\n", len(dates))
+// connectPrinter zakłada blokadę drukarki i łączy się z nią. Gdy drukarkę
+// obsługuje inny proces, zwraca *LockedError.
+func connectPrinter(o *Output, cfg *Config) (*FiscalClient, error) {
+	if err := lockPrinter(cfg); err != nil {
+		return nil, err
+	}
+	o.Printf("→ Łączę z drukarką %s:%d...\n", cfg.Printer.Host, cfg.Printer.Port)
 
-	fmt.Printf("\n📦 STAN MAGAZYNOWY:\n")
-	for _, p := range dataConfig.Products {
-		status := "✓"
-		if p.Stock == 0 {
-			status = "⚠"
-		} else if p.Stock < 0 {
-			status = "❌"
-		}
-		fmt.Printf("  %s %-15s: %d szt. (użyto: %d)\n", status, p.Name, p.Stock, p.Used)
+	enc, err := parseEncoding(cfg.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("błąd parsowania encoding: %w", err)
 	}
 
-	if totalErrors > 0 {
-		fmt.Printf("\n⚠ Zakończono z błędami\n")
-		os.Exit(1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Printer.Timeout)*time.Second)
+	defer cancel()
+
+	addr := fmt.Sprintf("%s:%d", cfg.Printer.Host, cfg.Printer.Port)
+	client, err := Dial(ctx, addr, enc, time.Duration(cfg.Printer.Timeout)*time.Second,
+		cfg.Printer.LogTX, cfg.Printer.LogRX)
+	if err != nil {
+		return nil, fmt.Errorf("błąd połączenia z drukarką: %w", err)
+	}
+
+	if cfg.Printer.Capture != "" {
+		rec, err := NewRecorder(cfg.Printer.Capture, addr)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		client.SetRecorder(rec)
+		o.Printf("⏺ Nagrywanie ruchu do %s\n", cfg.Printer.Capture)
 	}
 
-	fmt.Printf("\n✓ Zakończono pomyślnie\n")
+	o.Println("✓ Połączono z drukarką")
+	fc := NewFiscalClient(client, cfg.Fiscal.VATRate, cfg.Fiscal.PaymentType)
+	fc.SetCustomerDisplay(cfg.Printer.CustomerDisplay)
+	return fc, nil
+}
+
+// openPrinter wczytuje konfigurację i łączy się z drukarką. Przy błędzie
+// zwraca fc == nil i kod wyjścia.
+func openPrinter(o *Output, cf *configFlags) (*Config, *FiscalClient, int) {
+	cfg, err := loadConfig(o, cf)
+	if err != nil {
+		return nil, nil, fail(o, "Błąd: %v", err)
+	}
+	fc, err := connectPrinter(o, cfg)
+	if err != nil {
+		return cfg, nil, fail(o, "Błąd: %v", err)
+	}
+	return cfg, fc, exitOK
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Bieżące wersje formatów plików; plik bez pola version ma wersję 1.
+const (
+	ConfigVersion = 2
+	DataVersion   = 2
+)
+
+// migration przenosi dokument JSON z wersji from do from+1. Działa na
+// zdekodowanym obiekcie, więc widzi pola w postaci z pliku.
+type migration struct {
+	from        int
+	description string
+	apply       func(doc map[string]interface{}) error
+}
+
+var configMigrations = []migration{
+	{
+		from:        1,
+		description: "jawne wartości pól pominiętych w pliku (wcześniej przyjmowały wartość zerową, a nie domyślną)",
+		apply:       materializeLegacyZeros,
+	},
+}
+
+var dataMigrations = []migration{
+	{
+		from:        1,
+		description: "dodanie pola version",
+		apply:       func(map[string]interface{}) error { return nil },
+	},
+}
+
+// MigrationResult opisuje podniesienie wersji pliku.
+type MigrationResult struct {
+	File    string   `json:"file"`
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Applied []string `json:"applied,omitempty"`
+	Backup  string   `json:"backup,omitempty"`
+}
+
+func (r *MigrationResult) Upgraded() bool {
+	return r != nil && r.From < r.To
+}
+
+// docVersion zwraca wersję dokumentu z pola version.
+func docVersion(doc map[string]interface{}) (int, error) {
+	v, ok := doc["version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("nieprawidłowe pole version: %v", v)
+	}
+	version, err := n.Int64()
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("nieprawidłowe pole version: %s", n)
+	}
+	return int(version), nil
+}
+
+// upgradeJSON podnosi dokument JSON z pliku path do wersji current i zwraca
+// go w pamięci; sam plik nie jest zmieniany, a kopię oryginału zapisuje
+// dopiero config migrate (zob. backupOriginal).
+func upgradeJSON(path string, data []byte, migrations []migration, current int) ([]byte, map[string]interface{}, *MigrationResult, error) {
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, nil, fmt.Errorf("błąd parsowania JSON %s: %w", path, err)
+	}
+
+	from, err := docVersion(doc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	res := &MigrationResult{File: path, From: from, To: current}
+	if from > current {
+		return nil, nil, nil, fmt.Errorf("plik %s jest w wersji %d, a program obsługuje wersję %d - zaktualizuj program", path, from, current)
+	}
+	if from == current {
+		return data, doc, res, nil
+	}
+
+	for v := from; v < current; v++ {
+		var m *migration
+		for i := range migrations {
+			if migrations[i].from == v {
+				m = &migrations[i]
+			}
+		}
+		if m == nil {
+			return nil, nil, nil, fmt.Errorf("%s: brak migracji z wersji %d", path, v)
+		}
+		if err := m.apply(doc); err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: migracja z wersji %d: %w", path, v, err)
+		}
+		res.Applied = append(res.Applied, fmt.Sprintf("v%d→v%d: %s", v, v+1, m.description))
+	}
+	doc["version"] = current
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out, doc, res, nil
+}
+
+// backupOriginal zachowuje oryginał podnoszonego pliku jako
+// <plik>.v<wersja>.bak, o ile takiej kopii jeszcze nie ma.
+func backupOriginal(res *MigrationResult, data []byte) error {
+	res.Backup = fmt.Sprintf("%s.v%d.bak", res.File, res.From)
+	return writeBackup(res.Backup, data)
+}
+
+// writeBackup zapisuje kopię oryginału; istniejąca kopia nie jest
+// nadpisywana, aby zachować pierwszy oryginał.
+func writeBackup(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("błąd zapisu kopii zapasowej %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("błąd zapisu kopii zapasowej %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// legacyDefaults to pola, których pominięcie w pliku bez wersji nie
+// oznaczało wartości zerowej, bo z nią program nie działał: zerowy timeout
+// przerywał łączenie z drukarką od razu, a puste kodowanie było błędem.
+// Dostają bieżące wartości domyślne.
+var legacyDefaults = map[string]bool{
+	"printer.timeout": true,
+	"encoding":        true,
+}
+
+// materializeLegacyZeros zapisuje jawnie wartości zerowe pól pominiętych
+// w pliku bez wersji. Taki plik był wczytywany bez wartości domyślnych, więc
+// np. brak payment_type oznaczał gotówkę (0), a nie domyślne 8. Wyjątkiem
+// są pola z legacyDefaults.
+func materializeLegacyZeros(doc map[string]interface{}) error {
+	defaults := defaultConfig()
+	for _, f := range configFields(reflect.ValueOf(defaults).Elem(), "") {
+		if f.path == "version" || f.value.IsZero() {
+			continue
+		}
+		value := reflect.Zero(f.value.Type()).Interface()
+		switch {
+		case legacyDefaults[f.path]:
+			value = f.value.Interface()
+		case f.value.Kind() == reflect.Slice:
+			value = []interface{}{}
+		}
+		if err := setMissing(doc, f.path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMissing ustawia wartość pod ścieżką JSON, jeśli jej tam nie ma,
+// tworząc brakujące sekcje.
+func setMissing(doc map[string]interface{}, path string, value interface{}) error {
+	section, key, nested := strings.Cut(path, ".")
+	if !nested {
+		if _, ok := doc[path]; !ok {
+			doc[path] = value
+		}
+		return nil
+	}
+	sub, ok := doc[section].(map[string]interface{})
+	if !ok {
+		if _, exists := doc[section]; exists {
+			return fmt.Errorf("pole %s nie jest obiektem", section)
+		}
+		sub = make(map[string]interface{})
+		doc[section] = sub
+	}
+	return setMissing(sub, key, value)
+}
+
+// MigrateConfigFile zapisuje plik konfiguracji w bieżącej wersji. Plik
+// z nieznanymi polami nie jest zapisywany, aby ich nie utracić.
+func MigrateConfigFile(path string) (*MigrationResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu pliku config: %w", err)
+	}
+	out, doc, res, err := upgradeJSON(path, data, configMigrations, ConfigVersion)
+	if err != nil || !res.Upgraded() {
+		return res, err
+	}
+
+	problems := &ConfigError{}
+	checkFields(doc, reflect.TypeOf(Config{}), "", problems)
+	if err := problems.err(); err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON: %w", err)
+	}
+	if err := backupOriginal(res, data); err != nil {
+		return nil, err
+	}
+	return res, cfg.SaveConfig(path)
+}
+
+// MigrateDataFile zapisuje plik danych produktów w bieżącej wersji.
+func MigrateDataFile(path string) (*MigrationResult, error) {
+	if err := lockData(path); err != nil {
+		return nil, err
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu pliku data: %w", err)
+	}
+	data, err := LoadData(path)
+	if err != nil {
+		return nil, err
+	}
+	if !data.migrated.Upgraded() {
+		return data.migrated, nil
+	}
+	if err := backupOriginal(data.migrated, original); err != nil {
+		return nil, err
+	}
+	return data.migrated, data.SaveData(path, defaultDataBackups)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeJSON(t *testing.T) {
+	migrations := []migration{
+		{from: 1, description: "pole a", apply: func(doc map[string]interface{}) error {
+			doc["a"] = true
+			return nil
+		}},
+		{from: 2, description: "pole b", apply: func(doc map[string]interface{}) error {
+			doc["b"] = true
+			return nil
+		}},
+	}
+
+	tests := []struct {
+		name       string
+		json       string
+		current    int
+		wantFrom   int
+		wantFields []string
+		wantErr    string
+	}{
+		{name: "bieżąca wersja", json: `{"version": 3}`, current: 3, wantFrom: 3},
+		{name: "plik bez wersji", json: `{}`, current: 3, wantFrom: 1, wantFields: []string{"a", "b"}},
+		{name: "jedna migracja", json: `{"version": 2}`, current: 3, wantFrom: 2, wantFields: []string{"b"}},
+		{name: "nowsza wersja", json: `{"version": 4}`, current: 3, wantErr: "zaktualizuj program"},
+		{name: "nieprawidłowa wersja", json: `{"version": "2"}`, current: 3, wantErr: "nieprawidłowe pole version"},
+		{name: "brak migracji", json: `{}`, current: 4, wantErr: "brak migracji z wersji 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			out, doc, res, err := upgradeJSON(path, []byte(tt.json), migrations, tt.current)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nieoczekiwany błąd: %v", err)
+			}
+			if res.From != tt.wantFrom || res.To != tt.current {
+				t.Errorf("wersje %d→%d, oczekiwano %d→%d", res.From, res.To, tt.wantFrom, tt.current)
+			}
+			if len(res.Applied) != len(tt.wantFields) {
+				t.Errorf("migracje = %v, oczekiwano %d", res.Applied, len(tt.wantFields))
+			}
+
+			var written map[string]interface{}
+			if err := json.Unmarshal(out, &written); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range tt.wantFields {
+				if doc[field] != true || written[field] != true {
+					t.Errorf("brak pola %s po migracji: %s", field, out)
+				}
+			}
+			if v := written["version"]; v != float64(tt.current) {
+				t.Errorf("version = %v, oczekiwano %d", v, tt.current)
+			}
+
+			// zwykłe wczytanie nie zostawia kopii, robi ją dopiero config migrate
+			if matches, _ := filepath.Glob(path + "*.bak"); len(matches) > 0 || res.Backup != "" {
+				t.Errorf("kopie %v (%q) po wczytaniu w pamięci", matches, res.Backup)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	legacy := `{"printer": {"host": "10.0.0.1", "port": 6666}, "fiscal": {"payment_type": 3}}`
+	path := writeTestConfig(t, legacy)
+
+	res, err := MigrateConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := os.ReadFile(res.Backup)
+	if err != nil {
+		t.Fatalf("brak kopii oryginału: %v", err)
+	}
+	if string(backup) != legacy {
+		t.Errorf("kopia = %s, oczekiwano oryginału", backup)
+	}
+
+	cfg, err := LoadLayeredConfig(path, "", nil)
+	if err != nil {
+		t.Fatalf("plik po migracji niepoprawny: %v", err)
+	}
+	if cfg.migrated.Upgraded() {
+		t.Errorf("plik nadal w wersji %d", cfg.migrated.From)
+	}
+	if cfg.Printer.Timeout != 5 || cfg.Fiscal.PaymentType != 3 || cfg.Fiscal.ShippingChance != 0 {
+		t.Errorf("timeout %d, płatność %d, wysyłka %d; oczekiwano 5, 3, 0",
+			cfg.Printer.Timeout, cfg.Fiscal.PaymentType, cfg.Fiscal.ShippingChance)
+	}
+}
+
+func TestWriteBackupKeepsFirstOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json.v1.bak")
+	for _, content := range []string{"pierwszy", "drugi"} {
+		if err := writeBackup(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "pierwszy" {
+		t.Errorf("kopia = %q, oczekiwano pierwszego oryginału", data)
+	}
+}
+
+func TestMaterializeLegacyZeros(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		check   map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "brakujące pola dostają wartości zerowe lub dawne domyślne",
+			json: `{"printer": {"host": "10.0.0.1"}, "fiscal": {"payment_type": 3}}`,
+			check: map[string]interface{}{
+				"printer.host":                "10.0.0.1",
+				"printer.port":                0,
+				"printer.log_rx":              false,
+				"printer.timeout":             5,
+				"fiscal.payment_type":         json.Number("3"),
+				"fiscal.voucher_payment_type": 0,
+				"fiscal.vat_rates":            []interface{}{},
+				"encoding":                    "cp1250",
+			},
+		},
+		{
+			name:    "wartość zamiast sekcji",
+			json:    `{"printer": "10.0.0.1"}`,
+			wantErr: "printer nie jest obiektem",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, doc, _, err := upgradeJSON(filepath.Join(t.TempDir(), "config.json"), []byte(tt.json), nil, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = materializeLegacyZeros(doc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nieoczekiwany błąd: %v", err)
+			}
+			for path, want := range tt.check {
+				if got := lookupPath(doc, path); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, oczekiwano %#v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+// lookupPath zwraca wartość spod ścieżki JSON z kropkami.
+func lookupPath(doc map[string]interface{}, path string) interface{} {
+	section, key, nested := strings.Cut(path, ".")
+	if !nested {
+		return doc[path]
+	}
+	sub, _ := doc[section].(map[string]interface{})
+	return lookupPath(sub, key)
+}
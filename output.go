@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	OutputHuman = "human"
+	OutputJSON  = "json"
+)
+
+// Output kieruje komunikaty programu: w trybie human tekst dla operatora,
+// w trybie json jedno zdarzenie JSON na linię dla skryptów.
+type Output struct {
+	w    io.Writer
+	json bool
+	enc  *json.Encoder
+}
+
+type outputEvent struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+func NewOutput(w io.Writer, format string) (*Output, error) {
+	switch format {
+	case "", OutputHuman:
+		return &Output{w: w}, nil
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &Output{w: w, json: true, enc: enc}, nil
+	}
+	return nil, fmt.Errorf("nieznany format wyjścia %q (dozwolone: human|json)", format)
+}
+
+func (o *Output) JSON() bool { return o.json }
+
+func (o *Output) Printf(format string, args ...interface{}) {
+	if !o.json {
+		fmt.Fprintf(o.w, format, args...)
+	}
+}
+
+func (o *Output) Println(args ...interface{}) {
+	if !o.json {
+		fmt.Fprintln(o.w, args...)
+	}
+}
+
+func (o *Output) Print(args ...interface{}) {
+	if !o.json {
+		fmt.Fprint(o.w, args...)
+	}
+}
+
+// Event zapisuje zdarzenie w trybie json; w trybie human nic nie robi.
+func (o *Output) Event(name string, data interface{}) {
+	if o.json {
+		o.enc.Encode(outputEvent{Event: name, Time: time.Now(), Data: data})
+	}
+}
+
+func (o *Output) Warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	o.Printf("⚠ OSTRZEŻENIE: %s\n", msg)
+	o.Event("warning", MessageEvent{Message: msg})
+}
+
+type MessageEvent struct {
+	Message string `json:"message"`
+}
+
+type DayEvent struct {
+	Date       string        `json:"date"`
+	Count      int           `json:"count,omitempty"`
+	VAT        []EReceiptVAT `json:"vat,omitempty"`
+	Totalizers string        `json:"totalizers,omitempty"`
+	Diffs      []string      `json:"diffs,omitempty"`
+}
+
+// ReceiptEvent opisuje przetwarzanie jednej transakcji; Document to
+// paragon, faktura, zaliczka lub zwrot, kwoty są w groszach.
+type ReceiptEvent struct {
+	Date     string    `json:"date"`
+	Index    int       `json:"index"`
+	Count    int       `json:"count"`
+	Document string    `json:"document"`
+	OrderID  string    `json:"order_id,omitempty"`
+	Amount   int       `json:"amount"`
+	DryRun   bool      `json:"dry_run,omitempty"`
+	Receipt  *EReceipt `json:"receipt,omitempty"`
+	Products []string  `json:"products,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type ReportEvent struct {
+	Report  string `json:"report"`
+	Date    string `json:"date,omitempty"`
+	Summary bool   `json:"summary,omitempty"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type TotalsEvent struct {
+	Net   int `json:"net"`
+	VAT   int `json:"vat"`
+	Gross int `json:"gross"`
+}
+
+type SummaryEvent struct {
+	Receipts int           `json:"receipts"`
+	Returns  int           `json:"returns"`
+	Errors   int           `json:"errors"`
+	Days     int           `json:"days"`
+	VAT      []EReceiptVAT `json:"vat,omitempty"`
+	Totals   TotalsEvent   `json:"totals"`
+	Stock    []Product     `json:"stock"`
+}
+
+type StockEvent struct {
+	Products []Product `json:"products"`
+}
+
+type ConfigEvent struct {
+	Printer string           `json:"printer"`
+	Values  []EffectiveValue `json:"values"`
+}
+
+type ConfigCheckEvent struct {
+	File     string          `json:"file"`
+	Valid    bool            `json:"valid"`
+	Problems []ConfigProblem `json:"problems,omitempty"`
+}
+
+type FilesEvent struct {
+	Files []string `json:"files"`
+}
+
+type CashEvent struct {
+	Type   string `json:"type"`
+	Amount int    `json:"amount"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
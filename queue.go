@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JobReceipt     = "receipt"
+	JobDailyReport = "daily_report"
+
+	JobQueued   = "queued"
+	JobPrinting = "printing"
+	JobDone     = "done"
+	JobFailed   = "failed"
+
+	queueRetention    = 7 * 24 * time.Hour
+	keyRetention      = 90 * 24 * time.Hour
+	queuePollInterval = time.Second
+)
+
+// jobPriority ustala kolejność wykonania: mniejsza wartość wcześniej.
+// Raport dobowy wyprzedza oczekujące paragony.
+func jobPriority(kind string) int {
+	if kind == JobDailyReport {
+		return 0
+	}
+	return 10
+}
+
+// Job to zlecenie w kolejce. Zlecenia są wykonywane kolejno przez proces,
+// który trzyma blokadę drukarki.
+type Job struct {
+	ID             string        `json:"id"`
+	Kind           string        `json:"kind"`
+	Priority       int           `json:"priority"`
+	State          string        `json:"state"`
+	Source         string        `json:"source,omitempty"`
+	IdempotencyKey string        `json:"idempotency_key,omitempty"`
+	Hash           string        `json:"hash,omitempty"`
+	Transaction    *Transaction  `json:"transaction,omitempty"`
+	Receipt        *ReceiptEvent `json:"receipt,omitempty"`
+	Report         *ReportEvent  `json:"report,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Created        time.Time     `json:"created"`
+	Updated        time.Time     `json:"updated"`
+}
+
+// JobQueue to kolejka zleceń zapisana w katalogu, jeden plik JSON na
+// zlecenie. Pliki są zapisywane przez zmianę nazwy, więc kolejkę mogą
+// jednocześnie uzupełniać różne procesy.
+type JobQueue struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+func OpenJobQueue(dir string) (*JobQueue, error) {
+	for _, sub := range []string{"jobs", "keys"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("błąd tworzenia katalogu kolejki: %w", err)
+		}
+	}
+	return &JobQueue{dir: dir}, nil
+}
+
+func (q *JobQueue) jobPath(id string) string {
+	return filepath.Join(q.dir, "jobs", id+".json")
+}
+
+// keyPath zwraca plik klucza idempotencji usuniętego już zlecenia; nazwą
+// jest skrót klucza, bo klucz podaje klient API.
+func (q *JobQueue) keyPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(q.dir, "keys", hex.EncodeToString(sum[:])+".json")
+}
+
+// Add nadaje zleceniu identyfikator i zapisuje je jako oczekujące.
+func (q *JobQueue) Add(job *Job) error {
+	q.mu.Lock()
+	q.seq++
+	seq := q.seq
+	q.mu.Unlock()
+
+	now := time.Now()
+	job.ID = fmt.Sprintf("%s-%d-%04d", now.Format("20060102-150405"), os.Getpid(), seq)
+	job.Priority = jobPriority(job.Kind)
+	job.State = JobQueued
+	job.Created = now
+	job.Updated = now
+	return q.Save(job)
+}
+
+func (q *JobQueue) Save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji zlecenia: %w", err)
+	}
+	path := q.jobPath(job.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("błąd zapisu zlecenia %s: %w", job.ID, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("błąd zapisu zlecenia %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Get zwraca zlecenie o podanym identyfikatorze albo nil, jeśli go nie ma.
+func (q *JobQueue) Get(id string) (*Job, error) {
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return nil, nil
+	}
+	data, err := os.ReadFile(q.jobPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu zlecenia %s: %w", id, err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("błąd parsowania zlecenia %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// List zwraca wszystkie zlecenia w kolejności wykonania.
+func (q *JobQueue) List() ([]*Job, error) {
+	files, err := filepath.Glob(filepath.Join(q.dir, "jobs", "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu kolejki: %w", err)
+	}
+
+	var jobs []*Job
+	for _, file := range files {
+		job, err := q.Get(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return a.ID < b.ID
+	})
+	return jobs, nil
+}
+
+// Next zwraca pierwsze oczekujące zlecenie albo nil, gdy kolejka jest pusta.
+func (q *JobQueue) Next() (*Job, error) {
+	jobs, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.State == JobQueued {
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+func (q *JobQueue) Pending() (int, error) {
+	jobs, err := q.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, job := range jobs {
+		if job.State == JobQueued {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// FindKey zwraca zlecenie przyjęte z podanym kluczem idempotencji. Dla
+// zlecenia usuniętego już z kolejki zwraca jego zapis bez treści, dopóki
+// klucz jest przechowywany (keyRetention).
+func (q *JobQueue) FindKey(key string) (*Job, error) {
+	jobs, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.IdempotencyKey == key {
+			return job, nil
+		}
+	}
+
+	data, err := os.ReadFile(q.keyPath(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu klucza idempotencji: %w", err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("błąd parsowania klucza idempotencji: %w", err)
+	}
+	return &job, nil
+}
+
+// Recover oznacza jako nieudane zlecenia przerwane w trakcie druku.
+// Nie są one ponawiane automatycznie, bo dokument mógł zostać wydrukowany.
+func (q *JobQueue) Recover() ([]*Job, error) {
+	jobs, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	var recovered []*Job
+	for _, job := range jobs {
+		if job.State != JobPrinting {
+			continue
+		}
+		job.State = JobFailed
+		job.Error = "przerwane w trakcie druku - sprawdź, czy dokument został wydrukowany"
+		job.Updated = time.Now()
+		if err := q.Save(job); err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, job)
+	}
+	return recovered, nil
+}
+
+// Prune usuwa zakończone zlecenia starsze niż queueRetention. Klucz
+// idempotencji usuwanego zlecenia jest przechowywany dłużej, przez
+// keyRetention od zakończenia zlecenia, aby spóźnione powtórzenie żądania
+// nie wydrukowało dokumentu drugi raz.
+func (q *JobQueue) Prune() error {
+	jobs, err := q.List()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if (job.State == JobDone || job.State == JobFailed) && time.Since(job.Updated) > queueRetention {
+			if job.IdempotencyKey != "" {
+				if err := q.saveKey(job); err != nil {
+					return err
+				}
+			}
+			if err := os.Remove(q.jobPath(job.ID)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("błąd usuwania zlecenia %s: %w", job.ID, err)
+			}
+		}
+	}
+	return q.pruneKeys()
+}
+
+// saveKey zapisuje klucz idempotencji zlecenia razem z jego stanem, bez
+// treści transakcji i wyniku.
+func (q *JobQueue) saveKey(job *Job) error {
+	key := *job
+	key.Transaction, key.Receipt, key.Report = nil, nil, nil
+	data, err := json.MarshalIndent(&key, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji klucza idempotencji: %w", err)
+	}
+	if err := writeFileAtomic(q.keyPath(job.IdempotencyKey), data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu klucza idempotencji zlecenia %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// pruneKeys usuwa klucze idempotencji starsze niż keyRetention.
+func (q *JobQueue) pruneKeys() error {
+	files, err := filepath.Glob(filepath.Join(q.dir, "keys", "*.json"))
+	if err != nil {
+		return fmt.Errorf("błąd odczytu kluczy idempotencji: %w", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("błąd odczytu klucza idempotencji: %w", err)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return fmt.Errorf("błąd parsowania klucza idempotencji %s: %w", file, err)
+		}
+		if time.Since(job.Updated) > keyRetention {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("błąd usuwania klucza idempotencji: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Worker wykonuje zlecenia z kolejki w procesie, który trzyma blokadę
+// drukarki, i jest jedynym użytkownikiem połączenia z drukarką.
+type Worker struct {
+	queue   *JobQueue
+	cfg     *Config
+	session *PrintSession
+	out     *Output
+	dryRun  bool
+	wake    chan struct{}
+
+	scheduler *Scheduler
+
+	printerMu sync.Mutex
+	fc        *FiscalClient
+}
+
+func NewWorker(queue *JobQueue, cfg *Config, session *PrintSession, fc *FiscalClient, out *Output) *Worker {
+	return &Worker{
+		queue:   queue,
+		cfg:     cfg,
+		session: session,
+		out:     out,
+		dryRun:  fc == nil,
+		wake:    make(chan struct{}, 1),
+		fc:      fc,
+	}
+}
+
+// Notify budzi Run po dodaniu zlecenia w tym samym procesie; zlecenia
+// innych procesów są wykrywane co queuePollInterval.
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start porządkuje kolejkę przed rozpoczęciem pracy.
+func (w *Worker) Start() {
+	recovered, err := w.queue.Recover()
+	for _, job := range recovered {
+		w.out.Warn("zlecenie %s: %s", job.ID, job.Error)
+	}
+	if err != nil {
+		w.out.Warn("błąd odczytu kolejki: %v", err)
+	}
+	if err := w.queue.Prune(); err != nil {
+		w.out.Warn("%v", err)
+	}
+}
+
+// Drain wykonuje oczekujące zlecenia aż do opróżnienia kolejki i zwraca
+// ich liczbę. Gdy stanu zlecenia nie da się zapisać, Drain przerywa pracę;
+// zlecenie zostaje w kolejce i kolejny Tick spróbuje ponownie.
+func (w *Worker) Drain() int {
+	n := 0
+	for {
+		job, err := w.queue.Next()
+		if err != nil {
+			w.out.Warn("błąd odczytu kolejki: %v", err)
+			return n
+		}
+		if job == nil {
+			return n
+		}
+		if err := w.execute(job); err != nil {
+			w.out.Warn("%v", err)
+			return n
+		}
+		n++
+	}
+}
+
+// SetScheduler włącza harmonogram raportu dobowego sprawdzany przez Tick.
+func (w *Worker) SetScheduler(s *Scheduler) {
+	w.scheduler = s
+}
+
+// Tick sprawdza harmonogram i wykonuje oczekujące zlecenia.
+func (w *Worker) Tick() {
+	if w.scheduler != nil {
+		w.scheduler.Check(time.Now())
+	}
+	w.Drain()
+}
+
+// Run wykonuje zlecenia do anulowania ctx.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		w.Tick()
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-time.After(queuePollInterval):
+		}
+	}
+}
+
+// execute wykonuje zlecenie. Zlecenie, którego stanu printing nie udało
+// się zapisać, nie jest drukowane: po awarii procesu zostałoby wykonane
+// ponownie, bo na dysku nadal byłoby oczekujące.
+func (w *Worker) execute(job *Job) error {
+	if err := w.setState(job, JobPrinting, ""); err != nil {
+		return fmt.Errorf("zlecenie %s nie zostało wykonane: %w", job.ID, err)
+	}
+
+	err := w.WithPrinter(func(session *PrintSession) error {
+		switch job.Kind {
+		case JobReceipt:
+			if job.Transaction == nil {
+				return fmt.Errorf("zlecenie bez transakcji")
+			}
+			var err error
+			job.Receipt, err = session.Process(*job.Transaction, 1, 1)
+			return err
+		case JobDailyReport:
+			err := session.DailyReport(job.Source)
+			job.Report = &ReportEvent{Report: "daily", DryRun: w.dryRun}
+			if err != nil {
+				job.Report.Error = err.Error()
+			}
+			return err
+		}
+		return fmt.Errorf("nieznany rodzaj zlecenia %q", job.Kind)
+	})
+
+	w.session.Save()
+
+	state, errMsg := JobDone, ""
+	if err != nil {
+		state, errMsg = JobFailed, err.Error()
+	}
+	if err := w.setState(job, state, errMsg); err != nil {
+		// na dysku zlecenie zostaje w stanie printing, więc nie zostanie
+		// ponowione; Recover oznaczy je przy następnym uruchomieniu
+		return fmt.Errorf("zlecenie %s zakończone (%s), ale nie zapisano stanu: %w", job.ID, state, err)
+	}
+	return nil
+}
+
+// WithPrinter wykonuje fn na sesji drukowania z wyłącznym dostępem do
+// połączenia z drukarką; po utracie połączenia łączy się ponownie.
+func (w *Worker) WithPrinter(fn func(*PrintSession) error) error {
+	w.printerMu.Lock()
+	defer w.printerMu.Unlock()
+
+	if err := w.ensurePrinter(); err != nil {
+		return err
+	}
+	err := fn(w.session)
+	if err != nil {
+		w.dropPrinter(err)
+	}
+	return err
+}
+
+// setState zapisuje nowy stan zlecenia i ogłasza go dopiero po zapisie.
+func (w *Worker) setState(job *Job, state, errMsg string) error {
+	job.State = state
+	job.Error = errMsg
+	job.Updated = time.Now()
+	if err := w.queue.Save(job); err != nil {
+		return err
+	}
+
+	switch state {
+	case JobPrinting:
+		w.out.Printf("\n→ Zlecenie %s (%s)\n", job.ID, job.Kind)
+	case JobDone:
+		w.out.Printf("✓ Zlecenie %s wykonane\n", job.ID)
+	case JobFailed:
+		w.out.Printf("❌ Zlecenie %s nieudane: %s\n", job.ID, errMsg)
+	}
+	w.out.Event("job_"+state, job)
+	return nil
+}
+
+// Status odczytuje stan drukarki przez połączenie obsługujące kolejkę.
+func (w *Worker) Status() (map[string]string, error) {
+	w.printerMu.Lock()
+	defer w.printerMu.Unlock()
+
+	if err := w.ensurePrinter(); err != nil {
+		return nil, err
+	}
+	fields, err := w.fc.Status()
+	if err != nil {
+		w.dropPrinter(err)
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ensurePrinter łączy się ponownie z drukarką po utracie połączenia.
+// Wywołujący musi trzymać printerMu.
+func (w *Worker) ensurePrinter() error {
+	if w.dryRun || w.fc != nil {
+		return nil
+	}
+	fc, err := connectPrinter(w.out, w.cfg)
+	if err != nil {
+		return err
+	}
+	w.fc = fc
+	w.session.SetPrinter(fc)
+	return nil
+}
+
+// dropPrinter zamyka połączenie, jeśli błąd wskazuje na jego utratę;
+// kolejne zlecenie połączy się od nowa.
+func (w *Worker) dropPrinter(err error) {
+	if w.fc == nil || !isConnectionError(err) {
+		return
+	}
+	w.out.Warn("utracono połączenie z drukarką: %v", err)
+	w.fc.Close()
+	w.fc = nil
+}
+
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF)
+}
+
+// ClosePrinter zamyka połączenie z drukarką po zakończeniu pracy.
+func (w *Worker) ClosePrinter() {
+	w.printerMu.Lock()
+	defer w.printerMu.Unlock()
+	if w.fc != nil {
+		w.fc.Close()
+		w.fc = nil
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDrainSkipsJobWhenStateNotSaved(t *testing.T) {
+	queue, err := OpenJobQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{Kind: JobReceipt, Transaction: &Transaction{Date: "2025-12-01", Amount: 100}}
+	if err := queue.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	// katalog w miejscu pliku tymczasowego uniemożliwia zapis stanu
+	if err := os.Mkdir(queue.jobPath(job.ID)+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := NewOutput(io.Discard, OutputHuman)
+	// worker bez sesji: wykonanie zlecenia zakończyłoby test paniką
+	worker := NewWorker(queue, &Config{}, nil, nil, out)
+	if n := worker.Drain(); n != 0 {
+		t.Fatalf("wykonano %d zleceń, oczekiwano 0", n)
+	}
+
+	got, err := queue.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != JobQueued {
+		t.Errorf("stan = %s, oczekiwano %s", got.State, JobQueued)
+	}
+}
+
+func TestJobQueueRecover(t *testing.T) {
+	queue, err := OpenJobQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := []string{JobQueued, JobPrinting, JobDone}
+	for _, state := range states {
+		job := &Job{Kind: JobReceipt}
+		if err := queue.Add(job); err != nil {
+			t.Fatal(err)
+		}
+		job.State = state
+		if err := queue.Save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recovered, err := queue.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != 1 || recovered[0].State != JobFailed {
+		t.Fatalf("odzyskane = %+v, oczekiwano jednego nieudanego zlecenia", recovered)
+	}
+	if n, _ := queue.Pending(); n != 1 {
+		t.Errorf("oczekujące = %d, oczekiwano 1", n)
+	}
+}
+
+func TestPruneKeepsIdempotencyKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		age     time.Duration
+		wantJob bool
+		wantKey bool
+	}{
+		{name: "świeże zlecenie", age: time.Hour, wantJob: true, wantKey: true},
+		{name: "zlecenie usunięte, klucz zostaje", age: queueRetention + time.Hour, wantKey: true},
+		{name: "klucz po terminie", age: keyRetention + time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue, err := OpenJobQueue(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := &Job{Kind: JobReceipt, IdempotencyKey: "zam-1", Hash: "abc", Transaction: &Transaction{Date: "2025-12-01", Amount: 100}}
+			if err := queue.Add(job); err != nil {
+				t.Fatal(err)
+			}
+			job.State = JobDone
+			job.Updated = time.Now().Add(-tt.age)
+			if err := queue.Save(job); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := queue.Prune(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, _ := queue.Get(job.ID); (got != nil) != tt.wantJob {
+				t.Errorf("zlecenie w kolejce: %v, oczekiwano %v", got != nil, tt.wantJob)
+			}
+			found, err := queue.FindKey("zam-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (found != nil) != tt.wantKey {
+				t.Fatalf("klucz znaleziony: %v, oczekiwano %v", found != nil, tt.wantKey)
+			}
+			if found != nil && (found.ID != job.ID || found.Hash != job.Hash) {
+				t.Errorf("klucz wskazuje %s (%s), oczekiwano %s (%s)", found.ID, found.Hash, job.ID, job.Hash)
+			}
+		})
+	}
+}
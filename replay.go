@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// replayIdleTimeout to czas oczekiwania emulatora na kolejną ramkę programu.
+const replayIdleTimeout = 5 * time.Minute
+
+type FrameEvent struct {
+	Time     time.Time `json:"time,omitempty"`
+	Dir      string    `json:"dir"`
+	Frame    string    `json:"frame"`
+	Expected string    `json:"expected,omitempty"`
+	Match    *bool     `json:"match,omitempty"`
+	Invalid  string    `json:"invalid,omitempty"`
+}
+
+type ReplayEvent struct {
+	Frames     int `json:"frames"`
+	Mismatches int `json:"mismatches"`
+}
+
+// Emulator odtwarza nagraną sesję: odbiera ramki programu tak jak drukarka
+// i na każdą odpowiada ramkami RX, które w nagraniu nastąpiły po niej.
+// Ramki różne od nagranych są zgłaszane, ale sesja jest kontynuowana.
+type Emulator struct {
+	records []CaptureRecord
+	pos     int
+	enc     Encoding
+	out     *Output
+
+	Frames     int
+	Mismatches int
+}
+
+func NewEmulator(records []CaptureRecord, enc Encoding, out *Output) *Emulator {
+	return &Emulator{records: records, enc: enc, out: out}
+}
+
+func (e *Emulator) nextTX() int {
+	for i := e.pos; i < len(e.records); i++ {
+		if e.records[i].Dir == CaptureTX {
+			return i
+		}
+	}
+	return -1
+}
+
+// Done zwraca true, gdy w nagraniu nie ma już ramek do odtworzenia.
+func (e *Emulator) Done() bool {
+	return e.nextTX() < 0
+}
+
+// Serve obsługuje jedno połączenie programu do końca nagrania lub do
+// rozłączenia.
+func (e *Emulator) Serve(conn net.Conn) error {
+	c := newClient(conn, e.enc, replayIdleTimeout)
+	c.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer conn.Close()
+
+	for !e.Done() {
+		payload, err := c.ReadFrame(context.Background())
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := e.handle(c, []byte(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Emulator) handle(c *Client, got []byte) error {
+	i := e.nextTX()
+	want, _ := e.records[i].Bytes()
+	e.Frames++
+
+	match := bytes.Equal(got, want)
+	ev := FrameEvent{Dir: CaptureTX, Frame: DescribeFrame(e.enc, got), Match: &match}
+	if match {
+		e.out.Printf("→ %s\n", ev.Frame)
+	} else {
+		e.Mismatches++
+		ev.Expected = DescribeFrame(e.enc, want)
+		e.out.Printf("≠ %s\n  oczekiwano: %s\n", ev.Frame, ev.Expected)
+	}
+	e.out.Event("replay_frame", ev)
+
+	e.pos = i + 1
+	for e.pos < len(e.records) && e.records[e.pos].Dir == CaptureRX {
+		rec := e.records[e.pos]
+		resp, _ := rec.Bytes()
+		e.pos++
+
+		rev := FrameEvent{Dir: CaptureRX, Frame: DescribeFrame(e.enc, resp), Invalid: rec.Invalid}
+		if rec.Invalid != "" {
+			// odrzucona ramka jest odtwarzana razem z nagranym CRC
+			e.out.Printf("← %s (odrzucona: %s)\n", rev.Frame, rev.Invalid)
+			e.out.Event("replay_frame", rev)
+			if err := c.sendRaw(resp); err != nil {
+				return err
+			}
+			continue
+		}
+		e.out.Printf("← %s\n", rev.Frame)
+		e.out.Event("replay_frame", rev)
+		if err := c.SendBytes(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type ReturnRecord struct {
+	Number     string    `json:"number"`
+	Date       string    `json:"date"`
+	ReceiptRef string    `json:"receipt_ref"`
+	OrderID    string    `json:"order_id,omitempty"`
+	Products   []string  `json:"products"`
+	Amount     int       `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ReturnLedger struct {
+	Returns []ReturnRecord `json:"returns"`
+}
+
+func LoadReturns(path string) (*ReturnLedger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ReturnLedger{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu rejestru zwrotów: %w", err)
+	}
+
+	var ledger ReturnLedger
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON zwrotów: %w", err)
+	}
+	return &ledger, nil
+}
+
+func (l *ReturnLedger) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji JSON zwrotów: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru zwrotów: %w", err)
+	}
+
+	return nil
+}
+
+func (l *ReturnLedger) NewRecord(t Transaction) ReturnRecord {
+	return ReturnRecord{
+		Number:     fmt.Sprintf("ZW/%s/%d", strings.ReplaceAll(t.Date, "-", ""), l.countForDate(t.Date)+1),
+		Date:       t.Date,
+		ReceiptRef: t.ReturnRef,
+		OrderID:    t.OrderID,
+		Products:   t.ReturnProducts,
+		Amount:     -t.Amount,
+		CreatedAt:  time.Now(),
+	}
+}
+
+func (l *ReturnLedger) countForDate(date string) int {
+	n := 0
+	for _, r := range l.Returns {
+		if r.Date == date {
+			n++
+		}
+	}
+	return n
+}
+
+func (l *ReturnLedger) Add(r ReturnRecord) {
+	l.Returns = append(l.Returns, r)
+}
+
+func (fc *FiscalClient) PrintReturnDocument(r ReturnRecord) error {
+	form, err := fc.Form200Start(-1, "")
+	if err != nil {
+		return fmt.Errorf("błąd formstart: %w", err)
+	}
+	if err := printReturnForm(form, r); err != nil {
+		return form.Abort(err)
+	}
+	if err := form.End(); err != nil {
+		return fmt.Errorf("błąd formend: %w", err)
+	}
+
+	return fc.drainResponses(1500 * time.Millisecond)
+}
+
+func printReturnForm(form *SuperForm200, r ReturnRecord) error {
+	header := []string{
+		"DOKUMENT ZWROTU " + r.Number,
+		"Data zwrotu: " + r.Date,
+		"Do paragonu nr: " + r.ReceiptRef,
+	}
+	if r.OrderID != "" {
+		header = append(header, "Zamówienie: "+r.OrderID)
+	}
+	for _, l := range header {
+		if err := form.FormattedLine(l, ""); err != nil {
+			return err
+		}
+	}
+	if err := form.Cmd(1); err != nil {
+		return err
+	}
+
+	for _, p := range r.Products {
+		if err := form.FormattedLine("Zwrot: "+p, ""); err != nil {
+			return err
+		}
+	}
+	if err := form.Cmd(1); err != nil {
+		return err
+	}
+
+	if err := form.FormattedLine("Kwota zwrotu: "+formatAmount(r.Amount)+" zł", ""); err != nil {
+		return err
+	}
+	if err := form.Cmd(0); err != nil {
+		return err
+	}
+	if err := form.FormattedLine("Podpis klienta: .................", ""); err != nil {
+		return err
+	}
+	return form.FormattedLine("Podpis kasjera: .................", "")
+}
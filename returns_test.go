@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSession tworzy sesję z rejestrami w katalogu testu; fc == nil
+// oznacza tryb testowy.
+func newTestSession(t *testing.T, fc *FiscalClient, products ...Product) *PrintSession {
+	t.Helper()
+	dir := t.TempDir()
+	paths := SessionPaths{
+		Data:      filepath.Join(dir, "data.json"),
+		Shift:     filepath.Join(dir, "shift.json"),
+		Returns:   filepath.Join(dir, "returns.json"),
+		Advances:  filepath.Join(dir, "advances.json"),
+		Vouchers:  filepath.Join(dir, "vouchers.json"),
+		FiscalDay: filepath.Join(dir, "fiscalday.json"),
+		Documents: filepath.Join(dir, "documents.json"),
+	}
+	out, _ := NewOutput(io.Discard, OutputHuman)
+	s, err := NewPrintSession(CreateExampleConfig(), &DataConfig{Version: DataVersion, Products: products}, paths, fc, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestProcessReturn(t *testing.T) {
+	tests := []struct {
+		name      string
+		dryRun    bool
+		products  []string
+		wantErr   string
+		wantStock int
+		wantSaved int
+	}{
+		{name: "zwrot wydrukowany", products: []string{"Sweter"}, wantStock: 3, wantSaved: 1},
+		{name: "nieznany produkt", products: []string{"Sweter", "Kurtka"}, wantErr: "Kurtka", wantStock: 2},
+		{name: "tryb testowy nie zmienia stanu", dryRun: true, products: []string{"Sweter"}, wantStock: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fc *FiscalClient
+			var printer *fakePrinter
+			if !tt.dryRun {
+				fc, printer = newFakePrinter(t, okReply)
+			}
+			s := newTestSession(t, fc, Product{Name: "Sweter", Stock: 2, Used: 1})
+			trans := Transaction{Date: "2025-12-01", Amount: -5000, ReturnRef: "P/1", ReturnProducts: tt.products}
+
+			err := s.processReturn(trans, 1, 1, &ReceiptEvent{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				if cmds := printer.Commands(); len(cmds) != 0 {
+					t.Errorf("wysłano ramki mimo błędu: %v", cmds)
+				}
+			} else if err != nil {
+				t.Fatalf("nieoczekiwany błąd: %v", err)
+			}
+
+			if got := s.data.Products[0].Stock; got != tt.wantStock {
+				t.Errorf("stan = %d, oczekiwano %d", got, tt.wantStock)
+			}
+			// rejestr zapisany od razu po wydruku, bez czekania na Save
+			saved, err := LoadReturns(s.paths.Returns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(saved.Returns) != tt.wantSaved {
+				t.Errorf("zapisane zwroty = %d, oczekiwano %d", len(saved.Returns), tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestPrintReturnDocumentClosesFormOnError(t *testing.T) {
+	fc, printer := newFakePrinter(t, okReply)
+	record := ReturnRecord{Number: "ZW/20251201/1", Date: "2025-12-01", ReceiptRef: "P/1", Products: []string{"日本"}, Amount: 5000}
+
+	err := fc.PrintReturnDocument(record)
+	if err == nil || !strings.Contains(err.Error(), "formularz zamknięty") {
+		t.Fatalf("błąd = %v, oczekiwano zamknięcia formularza", err)
+	}
+	// komendy formularza nie czekają na odpowiedź, więc drukarka może
+	// jeszcze nie odczytać ostatniej ramki
+	deadline := time.Now().Add(time.Second)
+	for {
+		cmds := printer.Commands()
+		if len(cmds) > 0 && cmds[len(cmds)-1] == "formend" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("komendy = %v, oczekiwano formend na końcu", cmds)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	defaultReportRetryInterval = 300
+	defaultReportMaxAttempts   = 12
+
+	schedulerSource = "scheduler"
+)
+
+type SchedulerConfig struct {
+	DailyReportAt string `json:"daily_report_at"`
+	RetryInterval int    `json:"retry_interval,omitempty"`
+	MaxAttempts   int    `json:"max_attempts,omitempty"`
+}
+
+func (c SchedulerConfig) Enabled() bool {
+	return c.DailyReportAt != ""
+}
+
+func (c SchedulerConfig) validate(e *ConfigError) {
+	if c.DailyReportAt != "" {
+		if _, err := time.Parse("15:04", c.DailyReportAt); err != nil {
+			e.add("scheduler.daily_report_at", "nieprawidłowa godzina raportu dobowego: %q (oczekiwano GG:MM)", c.DailyReportAt)
+		}
+	}
+	if c.RetryInterval < 0 {
+		e.add("scheduler.retry_interval", "odstęp między próbami nie może być ujemny: %d", c.RetryInterval)
+	}
+	if c.MaxAttempts < 0 {
+		e.add("scheduler.max_attempts", "liczba prób nie może być ujemna: %d", c.MaxAttempts)
+	}
+}
+
+// Scheduler zleca raport dobowy o ustalonej godzinie, jeśli od ostatniego
+// raportu wydrukowano jakiekolwiek dokumenty, a raport za wcześniejszy dzień
+// zleca od razu. Nieudana próba jest ponawiana co RetryInterval, gdy
+// drukarka zgłosiła usterkę (np. brak papieru) lub zerwała połączenie.
+type Scheduler struct {
+	cfg    SchedulerConfig
+	at     time.Duration
+	queue  *JobQueue
+	ledger *FiscalDayLedger
+	out    *Output
+
+	gaveUp string
+}
+
+func NewScheduler(cfg SchedulerConfig, queue *JobQueue, ledger *FiscalDayLedger, out *Output) *Scheduler {
+	t, _ := time.Parse("15:04", cfg.DailyReportAt)
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = defaultReportRetryInterval
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = defaultReportMaxAttempts
+	}
+	return &Scheduler{
+		cfg:    cfg,
+		at:     time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute,
+		queue:  queue,
+		ledger: ledger,
+		out:    out,
+	}
+}
+
+// due zwraca powód zlecenia raportu albo "", jeśli raport nie jest jeszcze
+// potrzebny.
+func (s *Scheduler) due(now time.Time) string {
+	if s.ledger.Documents == 0 {
+		return ""
+	}
+	if missing := s.ledger.MissingReport(now); missing != "" {
+		return "brak raportu dobowego za " + missing
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if now.Before(midnight.Add(s.at)) {
+		return ""
+	}
+	return "raport dobowy o " + s.cfg.DailyReportAt
+}
+
+// Check dodaje raport dobowy do kolejki, jeśli nadszedł jego czas.
+func (s *Scheduler) Check(now time.Time) {
+	reason := s.due(now)
+	if reason == "" {
+		return
+	}
+
+	attempts := s.ledger.FailedAttempts(schedulerSource, now)
+	if n := len(attempts); n > 0 {
+		last := attempts[n-1]
+		if !last.Retryable || n >= s.cfg.MaxAttempts {
+			if s.gaveUp != fiscalDate(now) {
+				s.gaveUp = fiscalDate(now)
+				s.out.Warn("harmonogram: raport dobowy nie został wydrukowany po %d próbach (%s) - wydrukuj go ręcznie", n, last.Error)
+			}
+			return
+		}
+		if now.Sub(last.Time) < time.Duration(s.cfg.RetryInterval)*time.Second {
+			return
+		}
+	}
+
+	jobs, err := s.queue.List()
+	if err != nil {
+		s.out.Warn("harmonogram: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if job.Kind == JobDailyReport && (job.State == JobQueued || job.State == JobPrinting) {
+			return
+		}
+	}
+
+	job := &Job{Kind: JobDailyReport, Source: schedulerSource}
+	if err := s.queue.Add(job); err != nil {
+		s.out.Warn("harmonogram: %v", err)
+		return
+	}
+	s.out.Printf("\n⏰ Harmonogram: %s (próba %d)\n", reason, len(attempts)+1)
+	s.out.Event("job_queued", job)
+}
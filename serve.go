@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serveMaxBodySize = 1 << 20
+
+// ReceiptRequest to treść POST /receipts. Pola odpowiadają kolumnom pliku
+// CSV, kwota jest w groszach (ujemna dla zwrotu).
+type ReceiptRequest struct {
+	Date     string   `json:"date"`
+	Amount   int      `json:"amount"`
+	Type     string   `json:"type,omitempty"`
+	Order    string   `json:"order,omitempty"`
+	Invoice  string   `json:"invoice,omitempty"`
+	NIP      string   `json:"nip,omitempty"`
+	Buyer    string   `json:"buyer,omitempty"`
+	Address  string   `json:"address,omitempty"`
+	Term     string   `json:"term,omitempty"`
+	Copies   int      `json:"copies,omitempty"`
+	Ref      string   `json:"ref,omitempty"`
+	Products []string `json:"products,omitempty"`
+	Pack     []string `json:"pack,omitempty"`
+	PackRet  []string `json:"packret,omitempty"`
+	Voucher  string   `json:"voucher,omitempty"`
+	Store    string   `json:"store,omitempty"`
+}
+
+// Transaction sprawdza żądanie tymi samymi regułami co wiersz CSV.
+func (r *ReceiptRequest) Transaction() (Transaction, error) {
+	if r.Date == "" {
+		return Transaction{}, fmt.Errorf("brak daty (date)")
+	}
+	if _, err := time.Parse("2006-01-02", r.Date); err != nil {
+		return Transaction{}, fmt.Errorf("nieprawidłowa data %q (oczekiwano RRRR-MM-DD)", r.Date)
+	}
+	if r.Amount == 0 {
+		return Transaction{}, fmt.Errorf("kwota (amount, w groszach) nie może być zerowa")
+	}
+
+	var fields []string
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, key+"="+value)
+		}
+	}
+	add("type", r.Type)
+	add("order", r.Order)
+	add("invoice", r.Invoice)
+	add("nip", r.NIP)
+	add("buyer", r.Buyer)
+	add("address", r.Address)
+	add("term", r.Term)
+	if r.Copies != 0 {
+		add("copies", fmt.Sprint(r.Copies))
+	}
+	add("ref", r.Ref)
+	add("product", strings.Join(r.Products, "|"))
+	add("pack", strings.Join(r.Pack, "|"))
+	add("packret", strings.Join(r.PackRet, "|"))
+	add("voucher", r.Voucher)
+	add("store", r.Store)
+
+	t := Transaction{Date: r.Date, Amount: r.Amount}
+	if err := parseTransactionFields(fields, &t); err != nil {
+		return Transaction{}, err
+	}
+	return t, nil
+}
+
+type StatusResponse struct {
+	DryRun    bool              `json:"dry_run,omitempty"`
+	Connected bool              `json:"connected"`
+	Queued    int               `json:"queued"`
+	Printer   map[string]string `json:"printer,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server udostępnia drukarkę przez lokalne API HTTP/JSON. Przyjęte żądania
+// trafiają do kolejki zleceń, którą wykonuje worker tego procesu.
+type Server struct {
+	queue  *JobQueue
+	worker *Worker
+	out    *Output
+	dryRun bool
+
+	// mu chroni sprawdzenie klucza idempotencji razem z dodaniem zlecenia.
+	mu sync.Mutex
+}
+
+func NewServer(queue *JobQueue, worker *Worker, out *Output) *Server {
+	return &Server{queue: queue, worker: worker, out: out, dryRun: worker.dryRun}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /receipts", s.handleReceipt)
+	mux.HandleFunc("POST /reports/daily", s.handleDailyReport)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /jobs/{id}", s.handleJob)
+	return mux
+}
+
+func (s *Server) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, serveMaxBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "zbyt duże żądanie"})
+		return
+	}
+
+	var req ReceiptRequest
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("nieprawidłowy JSON: %v", err)})
+		return
+	}
+	trans, err := req.Transaction()
+	if err == nil {
+		err = s.worker.cfg.CheckStore(trans.Store)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	// skrót liczony z żądania po ponownej serializacji, aby ponowienie z inną
+	// kolejnością kluczy lub innymi odstępami nie było traktowane jak inne żądanie
+	canonical, err := json.Marshal(req)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	s.submit(w, r, &Job{Kind: JobReceipt, Source: "api", Transaction: &trans}, canonical)
+}
+
+func (s *Server) handleDailyReport(w http.ResponseWriter, r *http.Request) {
+	s.submit(w, r, &Job{Kind: JobDailyReport, Source: "api"}, nil)
+}
+
+// submit przyjmuje zlecenie do kolejki. Powtórzone żądanie z tym samym
+// nagłówkiem Idempotency-Key zwraca istniejące zlecenie zamiast drukować
+// ponownie; ten sam klucz z inną treścią (body w postaci kanonicznej) jest
+// odrzucany. Klucze działają przez keyRetention od zakończenia zlecenia,
+// także po usunięciu samego zlecenia z kolejki (queueRetention).
+func (s *Server) submit(w http.ResponseWriter, r *http.Request, job *Job, body []byte) {
+	sum := sha256.Sum256(append([]byte(job.Kind+"\n"), body...))
+	job.Hash = hex.EncodeToString(sum[:])
+	job.IdempotencyKey = r.Header.Get("Idempotency-Key")
+
+	s.mu.Lock()
+	if job.IdempotencyKey != "" {
+		prev, err := s.queue.FindKey(job.IdempotencyKey)
+		if err != nil {
+			s.mu.Unlock()
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		if prev != nil {
+			s.mu.Unlock()
+			if prev.Hash != job.Hash {
+				writeJSON(w, http.StatusConflict, errorResponse{Error: "klucz Idempotency-Key użyty dla innego żądania"})
+				return
+			}
+			w.Header().Set("Location", "/jobs/"+prev.ID)
+			writeJSON(w, http.StatusOK, prev)
+			return
+		}
+	}
+	err := s.queue.Add(job)
+	s.mu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+
+	s.out.Event("job_queued", job)
+	s.worker.Notify()
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Get(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+	if job == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "nie ma takiego zlecenia"})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	resp := StatusResponse{DryRun: s.dryRun}
+	if n, err := s.queue.Pending(); err == nil {
+		resp.Queued = n
+	}
+	if s.dryRun {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	fields, err := s.worker.Status()
+	if err != nil {
+		resp.Error = err.Error()
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	resp.Connected = true
+	resp.Printer = fields
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// Serve obsługuje API do anulowania ctx; worker kończy bieżące zlecenie,
+// a pozostałe czekają w kolejce na kolejne uruchomienie.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.worker.Run(workerCtx)
+		close(done)
+	}()
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = srv.Shutdown(shutdownCtx)
+		cancel()
+	case err = <-errc:
+		srv.Close()
+	}
+
+	stopWorker()
+	<-done
+	s.worker.ClosePrinter()
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	queue, err := OpenJobQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := NewOutput(io.Discard, OutputHuman)
+	worker := NewWorker(queue, &Config{}, nil, nil, out)
+	srv := httptest.NewServer(NewServer(queue, worker, out).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postReceipt(t *testing.T, url, key, body string) (int, Job) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url+"/receipts", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	return resp.StatusCode, job
+}
+
+func TestServeIdempotencyKey(t *testing.T) {
+	srv := newTestServer(t)
+
+	code, first := postReceipt(t, srv.URL, "k1", `{"date":"2025-12-01","amount":12300,"order":"ZAM-1"}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("pierwsze żądanie: kod %d, oczekiwano %d", code, http.StatusAccepted)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{
+			name: "inna kolejność kluczy i odstępy",
+			body: "{\n  \"order\": \"ZAM-1\",\n  \"amount\": 12300,\n  \"date\": \"2025-12-01\"\n}",
+			want: http.StatusOK,
+		},
+		{
+			name: "inna treść",
+			body: `{"date":"2025-12-01","amount":12400,"order":"ZAM-1"}`,
+			want: http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, job := postReceipt(t, srv.URL, "k1", tt.body)
+			if code != tt.want {
+				t.Fatalf("kod %d, oczekiwano %d", code, tt.want)
+			}
+			if code == http.StatusOK && job.ID != first.ID {
+				t.Errorf("zlecenie %s, oczekiwano istniejącego %s", job.ID, first.ID)
+			}
+		})
+	}
+}
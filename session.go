@@ -0,0 +1,655 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type SessionPaths struct {
+	Data      string
+	Shift     string
+	Returns   string
+	Advances  string
+	Vouchers  string
+	FiscalDay string
+	Documents string
+}
+
+func DefaultSessionPaths() SessionPaths {
+	return SessionPaths{
+		Data:      "data.json",
+		Shift:     "shift.json",
+		Returns:   "returns.json",
+		Advances:  "advances.json",
+		Vouchers:  "vouchers.json",
+		FiscalDay: "fiscalday.json",
+		Documents: "documents.json",
+	}
+}
+
+// PrintSession przetwarza transakcje (paragony, faktury, zaliczki, zwroty)
+// na jednej drukarce i prowadzi stan magazynowy oraz lokalne rejestry.
+// Sesja z fc == nil działa w trybie testowym.
+type PrintSession struct {
+	cfg      *Config
+	data     *DataConfig
+	paths    SessionPaths
+	fc       *FiscalClient
+	dryRun   bool
+	rnd      *rand.Rand
+	selector *ProductSelector
+	vatTable VATTable
+	out      *Output
+
+	shift     *ShiftLedger
+	returns   *ReturnLedger
+	advances  *AdvanceLedger
+	vouchers  *VoucherRegistry
+	fiscalDay *FiscalDayLedger
+	documents *DocumentLedger
+
+	shiftChanged     bool
+	returnsChanged   bool
+	advancesChanged  bool
+	fiscalDayChanged bool
+	documentsChanged bool
+
+	Receipts int
+	Returns  int
+	Errors   int
+
+	dayVAT       VATBreakdown
+	runVAT       VATBreakdown
+	totalsBefore Totalizers
+}
+
+func NewPrintSession(cfg *Config, data *DataConfig, paths SessionPaths, fc *FiscalClient, out *Output) (*PrintSession, error) {
+	vatTable, err := cfg.Fiscal.VATTable()
+	if err != nil {
+		return nil, fmt.Errorf("błąd tabeli VAT: %w", err)
+	}
+
+	s := &PrintSession{
+		cfg:      cfg,
+		data:     data,
+		paths:    paths,
+		fc:       fc,
+		dryRun:   fc == nil,
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		vatTable: vatTable,
+		out:      out,
+	}
+	s.selector = NewProductSelector(cfg, data, s.rnd)
+
+	if s.shift, err = LoadShift(paths.Shift); err != nil {
+		return nil, fmt.Errorf("błąd wczytywania zmiany: %w", err)
+	}
+	if s.returns, err = LoadReturns(paths.Returns); err != nil {
+		return nil, fmt.Errorf("błąd wczytywania rejestru zwrotów: %w", err)
+	}
+	if s.advances, err = LoadAdvances(paths.Advances); err != nil {
+		return nil, fmt.Errorf("błąd wczytywania rejestru zaliczek: %w", err)
+	}
+	if s.vouchers, err = LoadVouchers(paths.Vouchers); err != nil {
+		return nil, fmt.Errorf("błąd wczytywania rejestru bonów: %w", err)
+	}
+	if s.fiscalDay, err = LoadFiscalDay(paths.FiscalDay); err != nil {
+		return nil, err
+	}
+	if s.documents, err = LoadDocuments(paths.Documents); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetPrinter podmienia połączenie z drukarką, np. po ponownym połączeniu.
+func (s *PrintSession) SetPrinter(fc *FiscalClient) {
+	if !s.dryRun {
+		s.fc = fc
+	}
+}
+
+// FiscalDay zwraca rejestr dokumentów i raportów bieżącego dnia fiskalnego.
+func (s *PrintSession) FiscalDay() *FiscalDayLedger {
+	return s.fiscalDay
+}
+
+func (s *PrintSession) SetCashier(name string) {
+	if name != "" {
+		s.shift.Cashier = name
+		s.shiftChanged = true
+	}
+}
+
+func (s *PrintSession) BeginDay(date string, count int) {
+	s.out.Printf("\n═══════════════════════════════════════\n")
+	s.out.Printf("📅 Data: %s (%d paragonów)\n", date, count)
+	s.out.Printf("═══════════════════════════════════════\n")
+	s.out.Event("day_started", DayEvent{Date: date, Count: count})
+
+	s.selector = NewProductSelector(s.cfg, s.data, s.rnd)
+	s.dayVAT = nil
+	s.totalsBefore = nil
+	if !s.dryRun {
+		totals, err := s.fc.ReadTotalizers()
+		if err != nil {
+			s.out.Warn("nie udało się odczytać totalizerów: %v", err)
+			return
+		}
+		s.totalsBefore = totals
+	}
+}
+
+func (s *PrintSession) EndDay(date string) {
+	ev := DayEvent{Date: date, VAT: vatSummary(s.dayVAT, s.vatTable)}
+	if len(s.dayVAT) > 0 {
+		s.out.Printf("\n🧾 VAT dnia %s:\n", date)
+		for _, l := range s.dayVAT.Lines(s.vatTable) {
+			s.out.Printf("  %s\n", l)
+		}
+	}
+	if s.totalsBefore != nil {
+		totalsAfter, err := s.fc.ReadTotalizers()
+		if err != nil {
+			s.out.Warn("nie udało się odczytać totalizerów: %v", err)
+		} else if diffs := CompareTotalizers(s.totalsBefore, totalsAfter, s.dayVAT); len(diffs) > 0 {
+			s.out.Println("⚠ ROZBIEŻNOŚĆ Z TOTALIZERAMI DRUKARKI:")
+			for _, d := range diffs {
+				s.out.Printf("  • %s\n", d)
+			}
+			ev.Totalizers = "mismatch"
+			ev.Diffs = diffs
+		} else {
+			s.out.Println("✓ Totalizery drukarki zgodne z wyliczeniem VAT")
+			ev.Totalizers = "ok"
+		}
+	}
+	s.out.Event("day_finished", ev)
+	s.runVAT = s.runVAT.Add(s.dayVAT)
+	s.dayVAT = nil
+}
+
+func (s *PrintSession) Process(trans Transaction, pos, count int) (*ReceiptEvent, error) {
+	ev := &ReceiptEvent{
+		Date:     trans.Date,
+		Index:    pos,
+		Count:    count,
+		Document: documentType(trans),
+		OrderID:  trans.OrderID,
+		Amount:   trans.Amount,
+		DryRun:   s.dryRun,
+	}
+	s.out.Event("receipt_started", ev)
+
+	err := s.cfg.CheckStore(trans.Store)
+	switch {
+	case err != nil:
+	case trans.IsReturn():
+		err = s.processReturn(trans, pos, count, ev)
+	default:
+		err = s.processSale(trans, pos, count, ev)
+	}
+	if err != nil {
+		s.Errors++
+		ev.Error = err.Error()
+		s.out.Event("receipt_failed", ev)
+		return ev, err
+	}
+
+	s.out.Event("receipt_printed", ev)
+	return ev, nil
+}
+
+func documentType(trans Transaction) string {
+	switch {
+	case trans.IsReturn():
+		return "zwrot"
+	case trans.IsInvoice():
+		return "faktura"
+	case trans.Advance:
+		return "zaliczka"
+	case trans.Final:
+		return "rozliczenie"
+	}
+	return "paragon"
+}
+
+func (s *PrintSession) processReturn(trans Transaction, pos, count int, ev *ReceiptEvent) error {
+	s.out.Printf("\n[%d/%d] Zwrot %.2f zł do paragonu %s... ", pos, count, float64(-trans.Amount)/100.0, trans.ReturnRef)
+
+	// produkty sprawdzane przed wydrukiem, aby wydrukowany zwrot zawsze
+	// znalazł odbicie w stanie magazynowym
+	for _, name := range trans.ReturnProducts {
+		if !s.data.HasProduct(name) {
+			err := fmt.Errorf("produkt %s nie występuje w pliku danych", name)
+			s.out.Printf("❌ BŁĄD: %v\n", err)
+			return err
+		}
+	}
+
+	record := s.returns.NewRecord(trans)
+	ev.Products = record.Products
+	s.out.Println("✓")
+	for _, name := range record.Products {
+		s.out.Printf("  ↩ %s\n", name)
+	}
+
+	if !s.dryRun {
+		if err := s.fc.PrintReturnDocument(record); err != nil {
+			s.out.Printf("  ❌ BŁĄD DRUKOWANIA DOKUMENTU ZWROTU: %v\n", err)
+			return err
+		}
+		s.returns.Add(record)
+		s.returnsChanged = true
+		s.flush(&s.returnsChanged, func() error { return s.returns.Save(s.paths.Returns) }, "rejestru zwrotów")
+
+		for _, name := range record.Products {
+			if err := s.data.RestoreStock(name); err != nil {
+				s.out.Printf("  ❌ BŁĄD: %v\n", err)
+				return err
+			}
+		}
+	}
+
+	s.Returns++
+	return nil
+}
+
+func (s *PrintSession) processSale(trans Transaction, pos, count int, ev *ReceiptEvent) error {
+	cfg := s.cfg
+
+	docName := "Paragon"
+	if trans.IsInvoice() {
+		docName = "Faktura"
+	} else if trans.Advance {
+		docName = "Zaliczka"
+	}
+	s.out.Printf("\n[%d/%d] %s %.2f zł... ", pos, count, docName, float64(trans.Amount)/100.0)
+
+	if !s.dryRun {
+		if missing := s.fiscalDay.MissingReport(time.Now()); missing != "" {
+			err := fmt.Errorf("brak raportu dobowego za %s - wydrukuj go przed sprzedażą w nowym dniu", missing)
+			s.out.Printf("❌ BŁĄD: %v\n", err)
+			return err
+		}
+	}
+
+	receipt := &Receipt{
+		Total:      trans.Amount,
+		Packaging:  trans.Packaging,
+		Electronic: cfg.EReceipt.Mode == EReceiptElectronic,
+	}
+
+	var products []SelectedProduct
+	if trans.Advance {
+		receipt.Lines = append(receipt.Lines, ReceiptLine{
+			Name:     "Zaliczka na zam. " + trans.OrderID,
+			Price:    trans.Amount,
+			Quantity: 1.0,
+			VATRate:  cfg.Fiscal.VATRate,
+		})
+	} else {
+		var err error
+		products, err = s.selector.SelectProducts(trans.Amount)
+		if err != nil {
+			s.out.Printf("❌ BŁĄD: %v\n", err)
+			return err
+		}
+
+		for _, p := range products {
+			receipt.Lines = append(receipt.Lines, ReceiptLine{
+				Name:     p.Name,
+				Price:    p.Price,
+				Quantity: 1.0,
+				VATRate:  cfg.Fiscal.VATRate,
+			})
+		}
+
+		if trans.Final {
+			receipt.Advances = s.advances.Deductions(trans.OrderID)
+			if err := s.checkDeductions(trans, receipt); err != nil {
+				s.out.Printf("❌ BŁĄD: %v\n", err)
+				return err
+			}
+		}
+	}
+
+	for _, text := range cfg.Fiscal.FooterLines {
+		receipt.Footer = append(receipt.Footer, FooterLine{Type: FooterInfo, Text: text})
+	}
+	if trans.OrderID != "" {
+		receipt.Footer = append(receipt.Footer, FooterLine{Type: FooterSystemNumber, Text: trans.OrderID})
+	}
+
+	if trans.VoucherCode != "" {
+		amount, err := s.vouchers.Available(trans.VoucherCode, fiscalDate(time.Now()), receipt.AmountDue())
+		if err != nil {
+			s.out.Printf("❌ BŁĄD: %v\n", err)
+			return err
+		}
+		if amount > 0 {
+			receipt.Payments = append(receipt.Payments, Payment{
+				Type:   cfg.Fiscal.VoucherType(),
+				Name:   "Bon " + trans.VoucherCode,
+				Amount: amount,
+			})
+		}
+	}
+
+	if err := receipt.Validate(); err != nil {
+		s.out.Printf("❌ BŁĄD: %v\n", err)
+		return err
+	}
+
+	vat, err := s.vatTable.Calculate(receipt, cfg.Fiscal.VATRate)
+	if err != nil {
+		s.out.Printf("❌ BŁĄD: %v\n", err)
+		return err
+	}
+
+	s.out.Println("✓")
+	for _, line := range receipt.Lines {
+		s.out.Printf("  • %s: %.2f zł\n", line.Name, float64(line.Price)/100.0)
+	}
+	for _, adv := range receipt.Advances {
+		s.out.Printf("  − %s: -%.2f zł\n", adv.Name, float64(adv.Amount)/100.0)
+	}
+	for _, pack := range receipt.Packaging {
+		kind := "wydanie"
+		if pack.Returned {
+			kind = "zwrot"
+		}
+		s.out.Printf("  ♻ %s x%s: %.2f zł (%s)\n", pack.Name, formatQuantity(pack.Quantity), float64(lineValue(pack.Price, pack.Quantity))/100.0, kind)
+	}
+	if len(receipt.Packaging) > 0 || len(receipt.Advances) > 0 {
+		s.out.Printf("  = Do zapłaty: %.2f zł\n", float64(receipt.AmountDue())/100.0)
+	}
+	for _, payment := range receipt.Payments {
+		s.out.Printf("  🎟 %s: %.2f zł\n", payment.Name, float64(payment.Amount)/100.0)
+	}
+	if trans.OrderID != "" {
+		s.out.Printf("  # Nr systemowy: %s\n", trans.OrderID)
+	}
+	if s.dryRun {
+		for _, l := range vat.Lines(s.vatTable) {
+			s.out.Printf("  %% %s\n", l)
+		}
+	}
+
+	var invoice *Invoice
+	if trans.IsInvoice() {
+		invoice = &Invoice{
+			Receipt:      *receipt,
+			Number:       trans.InvoiceNumber,
+			BuyerName:    trans.BuyerName,
+			BuyerAddress: trans.BuyerAddress,
+			BuyerNIP:     trans.BuyerNIP,
+			PaymentTerm:  trans.PaymentTerm,
+			Copies:       trans.InvoiceCopies,
+		}
+		s.out.Printf("  # Faktura %s dla %s (NIP %s)\n", invoice.Number, invoice.BuyerName, invoice.BuyerNIP)
+	}
+
+	if !s.dryRun {
+		voucherAmount := receipt.PaymentsTotal()
+		if voucherAmount > 0 {
+			if err := s.chargeVoucher(trans.VoucherCode, voucherAmount); err != nil {
+				s.out.Printf("  ❌ BŁĄD: %v\n", err)
+				return err
+			}
+		}
+
+		var err error
+		if invoice != nil {
+			err = s.fc.PrintInvoice(invoice)
+		} else {
+			err = s.fc.PrintReceipt(receipt)
+		}
+		if err != nil {
+			var notPrinted *NotPrintedError
+			if voucherAmount > 0 && errors.As(err, &notPrinted) {
+				if rerr := s.chargeVoucher(trans.VoucherCode, -voucherAmount); rerr != nil {
+					err = fmt.Errorf("%w; nie udało się przywrócić %s zł na bon %s: %v", err, formatAmount(voucherAmount), trans.VoucherCode, rerr)
+				}
+			} else if voucherAmount > 0 {
+				// dokument mógł zostać wydrukowany, a zwrot na bon pozwoliłby
+				// wydać to samo saldo drugi raz
+				s.out.Warn("nie wiadomo, czy dokument został wydrukowany - %s zł pozostaje pobrane z bonu %s; sprawdź kopię elektroniczną i w razie potrzeby popraw saldo w %s",
+					formatAmount(voucherAmount), trans.VoucherCode, s.paths.Vouchers)
+			}
+			s.out.Printf("  ❌ BŁĄD DRUKOWANIA: %v\n", err)
+			return err
+		}
+	}
+
+	s.dayVAT = s.dayVAT.Add(vat)
+
+	printed := receipt
+	if invoice != nil {
+		printed = &invoice.Receipt
+	}
+	er := NewEReceipt(printed, invoice, trans, cfg.Fiscal.PaymentType, s.vatTable, vat)
+	ev.Receipt = er
+
+	if cfg.EReceipt.Enabled() {
+		if s.dryRun {
+			s.out.Println("  ✉ [SYMULACJA] e-paragon")
+		} else {
+			path, err := WriteEReceipt(cfg.EReceipt.Outbox, cfg.EReceipt.SignKey, er)
+			if err != nil {
+				s.out.Warn("nie udało się zapisać e-paragonu: %v", err)
+			} else {
+				s.out.Printf("  ✉ e-paragon: %s\n", path)
+			}
+		}
+	}
+
+	if !s.dryRun {
+		s.shift.AddReceipt(receipt.Total)
+		s.shiftChanged = true
+		s.fiscalDay.AddDocument(time.Now())
+		s.fiscalDayChanged = true
+		s.flush(&s.shiftChanged, func() error { return s.shift.Save(s.paths.Shift) }, "zmiany")
+		s.flush(&s.fiscalDayChanged, func() error { return s.fiscalDay.Save(s.paths.FiscalDay) }, "rejestru dnia fiskalnego")
+
+		doc := DocumentRecord{
+			Date:      trans.Date,
+			Document:  documentType(trans),
+			OrderID:   trans.OrderID,
+			Amount:    trans.Amount,
+			PrintedAt: time.Now(),
+		}
+		if invoice != nil {
+			doc.Invoice = invoice.Number
+		}
+		if err := s.documents.Add(printed.PrinterNumber, doc); err != nil {
+			s.out.Warn("dokument nie trafi do rejestru dokumentów: %v", err)
+		} else {
+			s.documentsChanged = true
+		}
+		s.flush(&s.documentsChanged, func() error { return s.documents.Save(s.paths.Documents) }, "rejestru dokumentów")
+
+		if trans.Advance {
+			s.advances.Add(trans.OrderID, AdvanceRecord{
+				Date:      trans.Date,
+				Amount:    trans.Amount,
+				VATRate:   cfg.Fiscal.VATRate,
+				CreatedAt: time.Now(),
+			})
+			s.advancesChanged = true
+		} else if len(receipt.Advances) > 0 {
+			s.advances.Settle(trans.OrderID, receipt.Advances)
+			s.advancesChanged = true
+		}
+		s.flush(&s.advancesChanged, func() error { return s.advances.Save(s.paths.Advances) }, "rejestru zaliczek")
+	}
+
+	if err := s.selector.DecrementStockPermanent(products); err != nil {
+		s.out.Warn("błąd aktualizacji stanu: %v", err)
+	}
+
+	s.Receipts++
+
+	if !s.dryRun {
+		time.Sleep(500 * time.Millisecond)
+	}
+	return nil
+}
+
+// chargeVoucher pobiera amount z salda bonu (ujemna kwota zwraca ją na bon)
+// i od razu zapisuje rejestr. Bon jest obciążany przed wydrukiem paragonu,
+// więc ani równoległe zlecenie, ani awaria po wydruku nie pozwolą wydać tego
+// samego salda dwa razy.
+func (s *PrintSession) chargeVoucher(code string, amount int) error {
+	registry, err := UpdateVouchers(s.paths.Vouchers, func(r *VoucherRegistry) error {
+		if amount < 0 {
+			return r.Refund(code, -amount)
+		}
+		return r.Redeem(code, amount)
+	})
+	if err != nil {
+		return err
+	}
+	s.vouchers = registry
+	return nil
+}
+
+// checkDeductions sprawdza przed wydrukiem, czy paragon końcowy ma co
+// rozliczyć i czy otwarte zaliczki nie przekraczają jego wartości.
+func (s *PrintSession) checkDeductions(trans Transaction, receipt *Receipt) error {
+	if len(receipt.Advances) == 0 {
+		return fmt.Errorf("zamówienie %s nie ma otwartych zaliczek do rozliczenia", trans.OrderID)
+	}
+	if total := receipt.AdvancesTotal(); total > receipt.Total {
+		return fmt.Errorf("zaliczki zamówienia %s (%s zł) przekraczają wartość paragonu końcowego %s zł", trans.OrderID, formatAmount(total), formatAmount(receipt.Total))
+	}
+	return nil
+}
+
+// DailyReport drukuje raport dobowy i zapisuje wynik w rejestrze dnia
+// fiskalnego; source wskazuje, kto zlecił raport.
+func (s *PrintSession) DailyReport(source string) error {
+	if s.dryRun {
+		s.out.Println("✓ [SYMULACJA] Raport dobowy")
+		s.out.Event("report_printed", ReportEvent{Report: "daily", DryRun: true})
+		return nil
+	}
+
+	now := time.Now()
+	rec := ReportRecord{Date: fiscalDate(now), Time: now, Source: source, Status: ReportPrinted}
+	defer func() {
+		s.fiscalDay.AddReport(rec)
+		s.fiscalDayChanged = true
+		s.flush(&s.fiscalDayChanged, func() error { return s.fiscalDay.Save(s.paths.FiscalDay) }, "rejestru dnia fiskalnego")
+	}()
+
+	s.out.Println("→ Drukuję raport dobowy...")
+	if err := s.fc.DailyReport(""); err != nil {
+		rec.Status = ReportFailed
+		rec.Error = err.Error()
+		rec.Retryable = s.printerFault(err)
+		s.out.Printf("❌ BŁĄD RAPORTU DOBOWEGO: %v\n", err)
+		s.out.Event("report_failed", ReportEvent{Report: "daily", Error: err.Error()})
+		s.Errors++
+		return err
+	}
+	s.out.Println("✓ Raport dobowy wydrukowany")
+	s.out.Event("report_printed", ReportEvent{Report: "daily"})
+	time.Sleep(2 * time.Second)
+	return nil
+}
+
+// printerFault sprawdza po nieudanym wydruku, czy przyczyną jest utrata
+// połączenia albo usterka zgłaszana przez drukarkę (pole pe odpowiedzi
+// sdev, np. brak papieru), po której usunięciu można ponowić wydruk.
+func (s *PrintSession) printerFault(err error) bool {
+	if isConnectionError(err) {
+		return true
+	}
+	fields, err := s.fc.Status()
+	if err != nil {
+		return true
+	}
+	pe := fields["pe"]
+	return pe != "" && pe != "0"
+}
+
+// flush zapisuje zmieniony rejestr. Po błędzie zmiana pozostaje oznaczona,
+// więc Save ponowi zapis na koniec przebiegu.
+func (s *PrintSession) flush(changed *bool, save func() error, what string) {
+	if !*changed {
+		return
+	}
+	if err := save(); err != nil {
+		s.out.Warn("nie udało się zapisać %s: %v", what, err)
+		return
+	}
+	*changed = false
+}
+
+func (s *PrintSession) Save() {
+	s.flush(&s.advancesChanged, func() error { return s.advances.Save(s.paths.Advances) }, "rejestru zaliczek")
+	s.flush(&s.returnsChanged, func() error { return s.returns.Save(s.paths.Returns) }, "rejestru zwrotów")
+
+	s.out.Printf("\n→ Zapisuję zaktualizowany stan magazynowy...\n")
+	if err := s.data.SaveData(s.paths.Data, s.cfg.DataBackupCount()); err != nil {
+		s.out.Warn("nie udało się zapisać stanu: %v", err)
+	} else {
+		s.out.Println("✓ Stan magazynowy zapisany")
+	}
+
+	if !s.dryRun {
+		s.flush(&s.shiftChanged, func() error { return s.shift.Save(s.paths.Shift) }, "zmiany")
+	}
+	s.flush(&s.fiscalDayChanged, func() error { return s.fiscalDay.Save(s.paths.FiscalDay) }, "rejestru dnia fiskalnego")
+
+	s.flush(&s.documentsChanged, func() error { return s.documents.Save(s.paths.Documents) }, "rejestru dokumentów")
+}
+
+func (s *PrintSession) PrintSummary(days int) {
+	s.out.Printf("\n═══════════════════════════════════════\n")
+	s.out.Printf("📊 PODSUMOWANIE\n")
+	s.out.Printf("═══════════════════════════════════════\n")
+	s.out.Printf("Wydrukowanych paragonów: %d\n", s.Receipts)
+	s.out.Printf("Zwrotów: %d\n", s.Returns)
+	s.out.Printf("Błędów: %d\n", s.Errors)
+	s.out.Printf("Dni przetworzonych: %d\n", days)
+
+	if len(s.runVAT) > 0 {
+		s.out.Printf("\n🧾 ROZBICIE VAT:\n")
+		for _, l := range s.runVAT.Lines(s.vatTable) {
+			s.out.Printf("  %s\n", l)
+		}
+		net, vat, gross := s.runVAT.Totals()
+		s.out.Printf("  RAZEM netto %s  VAT %s  brutto %s\n", formatAmount(net), formatAmount(vat), formatAmount(gross))
+	}
+
+	printStock(s.out, s.data)
+
+	net, vat, gross := s.runVAT.Totals()
+	s.out.Event("summary", SummaryEvent{
+		Receipts: s.Receipts,
+		Returns:  s.Returns,
+		Errors:   s.Errors,
+		Days:     days,
+		VAT:      vatSummary(s.runVAT, s.vatTable),
+		Totals:   TotalsEvent{Net: net, VAT: vat, Gross: gross},
+		Stock:    s.data.Products,
+	})
+}
+
+func printStock(out *Output, data *DataConfig) {
+	out.Printf("\n📦 STAN MAGAZYNOWY:\n")
+	for _, p := range data.Products {
+		status := "✓"
+		if p.Stock == 0 {
+			status = "⚠"
+		} else if p.Stock < 0 {
+			status = "❌"
+		}
+		out.Printf("  %s %-15s: %d szt. (użyto: %d)\n", status, p.Name, p.Stock, p.Used)
+	}
+}
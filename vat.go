@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var defaultVATRates = []string{"23", "8", "5", "0", "zw"}
+
+const vatExempt = -1
+
+// VATTable mapuje indeks stawki drukarki (vt0-vt6, litery A-G) na stawkę
+// w setnych częściach procenta; vatExempt oznacza stawkę zwolnioną.
+type VATTable map[int]int
+
+func ParseVATTable(rates []string) (VATTable, error) {
+	if len(rates) == 0 {
+		rates = slices.Clone(defaultVATRates)
+	}
+	if len(rates) > 7 {
+		return nil, fmt.Errorf("za dużo stawek VAT: %d (maksymalnie 7, A-G)", len(rates))
+	}
+
+	table := make(VATTable)
+	for i, r := range rates {
+		r = strings.ToLower(strings.TrimSpace(r))
+		switch r {
+		case "":
+			continue
+		case "zw":
+			table[i] = vatExempt
+			continue
+		}
+		pct, err := strconv.ParseFloat(strings.ReplaceAll(r, ",", "."), 64)
+		if err != nil || pct < 0 || pct >= 100 {
+			return nil, fmt.Errorf("nieprawidłowa stawka VAT %s: %q", vatLetter(i), r)
+		}
+		table[i] = int(pct*100 + 0.5)
+	}
+	return table, nil
+}
+
+func (t VATTable) Label(index int) string {
+	rate, ok := t[index]
+	switch {
+	case !ok:
+		return "nieaktywna"
+	case rate == vatExempt:
+		return "zw"
+	case rate%100 == 0:
+		return fmt.Sprintf("%d%%", rate/100)
+	default:
+		return strings.ReplaceAll(strconv.FormatFloat(float64(rate)/100, 'f', -1, 64), ".", ",") + "%"
+	}
+}
+
+type VATEntry struct {
+	Index int
+	Gross int
+	Net   int
+	VAT   int
+}
+
+type VATBreakdown []VATEntry
+
+// vatFromGross liczy podatek od sumy brutto w danej stawce tak jak drukarka:
+// VAT = brutto * stawka / (100 + stawka), zaokrąglony do grosza (połówki w górę).
+func vatFromGross(gross, rate int) int {
+	if rate <= 0 {
+		return 0
+	}
+	sign := 1
+	if gross < 0 {
+		sign = -1
+		gross = -gross
+	}
+	den := 10000 + rate
+	return sign * ((gross*rate*2 + den) / (2 * den))
+}
+
+func (t VATTable) Calculate(receipt *Receipt, defaultRate int) (VATBreakdown, error) {
+	gross := make(map[int]int)
+	rateOf := func(r int) int {
+		if r < 0 {
+			return defaultRate
+		}
+		return r
+	}
+
+	for _, line := range receipt.Lines {
+		gross[rateOf(line.VATRate)] += lineValue(line.Price, line.Quantity)
+	}
+	for _, adv := range receipt.Advances {
+		gross[rateOf(adv.VATRate)] -= adv.Amount
+	}
+
+	var out VATBreakdown
+	for index := 0; index <= 6; index++ {
+		g, ok := gross[index]
+		if !ok {
+			continue
+		}
+		rate, active := t[index]
+		if !active {
+			return nil, fmt.Errorf("stawka VAT %s jest nieaktywna", vatLetter(index))
+		}
+		vat := vatFromGross(g, rate)
+		out = append(out, VATEntry{Index: index, Gross: g, Net: g - vat, VAT: vat})
+	}
+	return out, nil
+}
+
+func (b VATBreakdown) Add(other VATBreakdown) VATBreakdown {
+	for _, o := range other {
+		found := false
+		for i := range b {
+			if b[i].Index == o.Index {
+				b[i].Gross += o.Gross
+				b[i].Net += o.Net
+				b[i].VAT += o.VAT
+				found = true
+				break
+			}
+		}
+		if !found {
+			b = append(b, o)
+		}
+	}
+	for i := 1; i < len(b); i++ {
+		for j := i; j > 0 && b[j-1].Index > b[j].Index; j-- {
+			b[j-1], b[j] = b[j], b[j-1]
+		}
+	}
+	return b
+}
+
+func (b VATBreakdown) Totals() (net, vat, gross int) {
+	for _, e := range b {
+		net += e.Net
+		vat += e.VAT
+		gross += e.Gross
+	}
+	return net, vat, gross
+}
+
+func (b VATBreakdown) Lines(t VATTable) []string {
+	var out []string
+	for _, e := range b {
+		out = append(out, fmt.Sprintf("VAT %s %-5s netto %10s  VAT %9s  brutto %10s",
+			vatLetter(e.Index), t.Label(e.Index), formatAmount(e.Net), formatAmount(e.VAT), formatAmount(e.Gross)))
+	}
+	return out
+}
+
+// Totalizers to sumy brutto i VAT w poszczególnych stawkach odczytane z drukarki.
+type Totalizers map[int]VATEntry
+
+func (fc *FiscalClient) ReadTotalizers() (Totalizers, error) {
+	var payload []byte
+	payload = append(payload, []byte("totget")...)
+	payload = append(payload, TAB)
+
+	fields, err := fc.query(context.Background(), "totget", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(Totalizers)
+	for index := 0; index <= 6; index++ {
+		letter := strings.ToLower(vatLetter(index))
+		grossStr, hasGross := fields["g"+letter]
+		vatStr, hasVAT := fields["v"+letter]
+		if !hasGross && !hasVAT {
+			continue
+		}
+		gross, err := strconv.Atoi(grossStr)
+		if err != nil {
+			return nil, fmt.Errorf("nieprawidłowy totalizer brutto %s: %q", vatLetter(index), grossStr)
+		}
+		vat, err := strconv.Atoi(vatStr)
+		if err != nil {
+			return nil, fmt.Errorf("nieprawidłowy totalizer VAT %s: %q", vatLetter(index), vatStr)
+		}
+		totals[index] = VATEntry{Index: index, Gross: gross, Net: gross - vat, VAT: vat}
+	}
+	return totals, nil
+}
+
+// CompareTotalizers porównuje przyrost totalizerów (after - before) z wyliczonym
+// rozbiciem VAT i zwraca opis rozbieżności.
+func CompareTotalizers(before, after Totalizers, expected VATBreakdown) []string {
+	var diffs []string
+	seen := make(map[int]bool)
+	for _, e := range expected {
+		seen[e.Index] = true
+		gross := after[e.Index].Gross - before[e.Index].Gross
+		vat := after[e.Index].VAT - before[e.Index].VAT
+		if gross != e.Gross || vat != e.VAT {
+			diffs = append(diffs, fmt.Sprintf("stawka %s: drukarka brutto %s / VAT %s, wyliczono brutto %s / VAT %s",
+				vatLetter(e.Index), formatAmount(gross), formatAmount(vat), formatAmount(e.Gross), formatAmount(e.VAT)))
+		}
+	}
+	for index, a := range after {
+		if seen[index] {
+			continue
+		}
+		if gross := a.Gross - before[index].Gross; gross != 0 {
+			diffs = append(diffs, fmt.Sprintf("stawka %s: drukarka brutto %s, wyliczono 0,00", vatLetter(index), formatAmount(gross)))
+		}
+	}
+	return diffs
+}
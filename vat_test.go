@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVATFromGross(t *testing.T) {
+	tests := []struct {
+		gross, rate, want int
+	}{
+		{12300, 2300, 2300},
+		{100, 2300, 19},
+		{-100, 2300, -19},
+		{10800, 800, 800},
+		{999, 800, 74},
+		{1, 2300, 0},
+		{5000, 0, 0},
+		{5000, vatExempt, 0},
+	}
+	for _, tt := range tests {
+		if got := vatFromGross(tt.gross, tt.rate); got != tt.want {
+			t.Errorf("vatFromGross(%d, %d) = %d, oczekiwano %d", tt.gross, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestParseVATTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		rates   []string
+		want    VATTable
+		wantErr string
+	}{
+		{name: "domyślna", want: VATTable{0: 2300, 1: 800, 2: 500, 3: 0, 4: vatExempt}},
+		{name: "przecinek i stawka nieaktywna", rates: []string{"23", "", "7,5"}, want: VATTable{0: 2300, 2: 750}},
+		{name: "za dużo stawek", rates: []string{"1", "2", "3", "4", "5", "6", "7", "8"}, wantErr: "za dużo"},
+		{name: "stawka spoza zakresu", rates: []string{"100"}, wantErr: "nieprawidłowa stawka VAT A"},
+		{name: "tekst", rates: []string{"23", "abc"}, wantErr: "nieprawidłowa stawka VAT B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVATTable(tt.rates)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tabela = %v, oczekiwano %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVATTableLabel(t *testing.T) {
+	table := VATTable{0: 2300, 1: 750, 4: vatExempt}
+	for index, want := range map[int]string{0: "23%", 1: "7,5%", 4: "zw", 5: "nieaktywna"} {
+		if got := table.Label(index); got != want {
+			t.Errorf("Label(%d) = %q, oczekiwano %q", index, got, want)
+		}
+	}
+}
+
+func TestVATTableCalculate(t *testing.T) {
+	table := VATTable{0: 2300, 1: 800, 4: vatExempt}
+	tests := []struct {
+		name    string
+		receipt Receipt
+		want    VATBreakdown
+		wantErr string
+	}{
+		{
+			name: "stawka domyślna i kilka pozycji w jednej stawce",
+			receipt: Receipt{Lines: []ReceiptLine{
+				{Price: 50, Quantity: 1, VATRate: -1},
+				{Price: 50, Quantity: 1, VATRate: 0},
+			}},
+			// VAT liczony od sumy brutto stawki, a nie od każdej pozycji
+			want: VATBreakdown{{Index: 0, Gross: 100, Net: 81, VAT: 19}},
+		},
+		{
+			name: "kilka stawek i ilość",
+			receipt: Receipt{Lines: []ReceiptLine{
+				{Price: 12300, Quantity: 1, VATRate: 0},
+				{Price: 5400, Quantity: 2, VATRate: 1},
+				{Price: 1000, Quantity: 1, VATRate: 4},
+			}},
+			want: VATBreakdown{
+				{Index: 0, Gross: 12300, Net: 10000, VAT: 2300},
+				{Index: 1, Gross: 10800, Net: 10000, VAT: 800},
+				{Index: 4, Gross: 1000, Net: 1000, VAT: 0},
+			},
+		},
+		{
+			name: "odliczona zaliczka",
+			receipt: Receipt{
+				Lines:    []ReceiptLine{{Price: 45000, Quantity: 1, VATRate: 0}},
+				Advances: []AdvanceDeduction{{Amount: 12300, VATRate: 0}},
+			},
+			want: VATBreakdown{{Index: 0, Gross: 32700, Net: 26585, VAT: 6115}},
+		},
+		{
+			name:    "stawka nieaktywna",
+			receipt: Receipt{Lines: []ReceiptLine{{Price: 100, Quantity: 1, VATRate: 2}}},
+			wantErr: "stawka VAT C jest nieaktywna",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := table.Calculate(&tt.receipt, 0)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rozbicie = %+v, oczekiwano %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVATBreakdownAdd(t *testing.T) {
+	a := VATBreakdown{{Index: 1, Gross: 108, Net: 100, VAT: 8}}
+	b := VATBreakdown{{Index: 0, Gross: 123, Net: 100, VAT: 23}, {Index: 1, Gross: 108, Net: 100, VAT: 8}}
+
+	got := a.Add(b)
+	want := VATBreakdown{{Index: 0, Gross: 123, Net: 100, VAT: 23}, {Index: 1, Gross: 216, Net: 200, VAT: 16}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suma = %+v, oczekiwano %+v", got, want)
+	}
+	if net, vat, gross := got.Totals(); net != 300 || vat != 39 || gross != 339 {
+		t.Errorf("Totals() = %d, %d, %d", net, vat, gross)
+	}
+}
+
+func TestCompareTotalizers(t *testing.T) {
+	before := Totalizers{0: {Index: 0, Gross: 1000, VAT: 187}}
+	expected := VATBreakdown{{Index: 0, Gross: 12300, Net: 10000, VAT: 2300}}
+
+	match := Totalizers{0: {Index: 0, Gross: 13300, VAT: 2487}}
+	if diffs := CompareTotalizers(before, match, expected); len(diffs) != 0 {
+		t.Errorf("nieoczekiwane rozbieżności: %v", diffs)
+	}
+
+	mismatch := Totalizers{0: {Index: 0, Gross: 13300, VAT: 2488}, 1: {Index: 1, Gross: 500, VAT: 37}}
+	if diffs := CompareTotalizers(before, mismatch, expected); len(diffs) != 2 {
+		t.Errorf("rozbieżności = %v, oczekiwano 2", diffs)
+	}
+}
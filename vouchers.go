@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type Voucher struct {
+	Code      string `json:"code"`
+	FaceValue int    `json:"face_value"`
+	Balance   int    `json:"balance"`
+	Expiry    string `json:"expiry,omitempty"`
+}
+
+type VoucherRegistry struct {
+	Vouchers []Voucher `json:"vouchers"`
+}
+
+func LoadVouchers(path string) (*VoucherRegistry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &VoucherRegistry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("błąd odczytu rejestru bonów: %w", err)
+	}
+
+	var registry VoucherRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("błąd parsowania JSON bonów: %w", err)
+	}
+	return &registry, nil
+}
+
+func (r *VoucherRegistry) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("błąd serializacji JSON bonów: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data, 0); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru bonów: %w", err)
+	}
+
+	return nil
+}
+
+// vouchersLockWait to czas oczekiwania na blokadę rejestru bonów trzymaną
+// przez inny proces na czas jednej zmiany salda.
+const vouchersLockWait = 10 * time.Second
+
+// UpdateVouchers zmienia rejestr bonów w pliku path: pod blokadą wczytuje go
+// ponownie z dysku, stosuje change i zapisuje atomowo. Dzięki temu dwa procesy
+// nie wydadzą tego samego salda bonu. Zwraca rejestr po zmianie.
+func UpdateVouchers(path string, change func(*VoucherRegistry) error) (*VoucherRegistry, error) {
+	lock, err := WaitLock(path+".lock", vouchersLockWait)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	registry, err := LoadVouchers(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(registry); err != nil {
+		return nil, err
+	}
+	if err := registry.Save(path); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+func (r *VoucherRegistry) find(code string) *Voucher {
+	for i := range r.Vouchers {
+		if strings.EqualFold(r.Vouchers[i].Code, code) {
+			return &r.Vouchers[i]
+		}
+	}
+	return nil
+}
+
+func (r *VoucherRegistry) Issue(code string, value int, expiry string) error {
+	code = normalizeVoucherCode(code)
+	if code == "" {
+		return fmt.Errorf("brak kodu bonu")
+	}
+	if value <= 0 {
+		return fmt.Errorf("bon %s: wartość musi być dodatnia", code)
+	}
+	if expiry != "" {
+		if _, err := time.Parse("2006-01-02", expiry); err != nil {
+			return fmt.Errorf("bon %s: nieprawidłowa data ważności %q", code, expiry)
+		}
+	}
+	if r.find(code) != nil {
+		return fmt.Errorf("bon %s: już istnieje", code)
+	}
+
+	r.Vouchers = append(r.Vouchers, Voucher{
+		Code:      code,
+		FaceValue: value,
+		Balance:   value,
+		Expiry:    expiry,
+	})
+	return nil
+}
+
+// Available zwraca kwotę, jaką można pokryć bonem w dniu date (YYYY-MM-DD),
+// nie większą niż due.
+func (r *VoucherRegistry) Available(code string, date string, due int) (int, error) {
+	v := r.find(code)
+	if v == nil {
+		return 0, fmt.Errorf("bon %s: nie znaleziono", code)
+	}
+	if v.Expiry != "" && date > v.Expiry {
+		return 0, fmt.Errorf("bon %s: ważny do %s", v.Code, v.Expiry)
+	}
+	if v.Balance <= 0 {
+		return 0, fmt.Errorf("bon %s: wykorzystany", v.Code)
+	}
+	if v.Balance < due {
+		return v.Balance, nil
+	}
+	return due, nil
+}
+
+func (r *VoucherRegistry) Redeem(code string, amount int) error {
+	v := r.find(code)
+	if v == nil {
+		return fmt.Errorf("bon %s: nie znaleziono", code)
+	}
+	if amount > v.Balance {
+		return fmt.Errorf("bon %s: niewystarczające saldo %d gr (wymagane %d gr)", v.Code, v.Balance, amount)
+	}
+	v.Balance -= amount
+	return nil
+}
+
+// Refund przywraca na bon kwotę pobraną przed nieudanym wydrukiem.
+func (r *VoucherRegistry) Refund(code string, amount int) error {
+	v := r.find(code)
+	if v == nil {
+		return fmt.Errorf("bon %s: nie znaleziono", code)
+	}
+	v.Balance += amount
+	return nil
+}
+
+func normalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func ParseVoucherSpec(s string) (code string, value int, expiry string, err error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", 0, "", fmt.Errorf("nieprawidłowy bon %q (oczekiwano KOD:WARTOŚĆ[:YYYY-MM-DD])", s)
+	}
+	value, err = parseAmount(parts[1])
+	if err != nil {
+		return "", 0, "", fmt.Errorf("nieprawidłowa wartość bonu %q", parts[1])
+	}
+	if len(parts) == 3 {
+		expiry = strings.TrimSpace(parts[2])
+	}
+	return normalizeVoucherCode(parts[0]), value, expiry, nil
+}
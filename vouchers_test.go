@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVoucherRegistryAvailable(t *testing.T) {
+	r := &VoucherRegistry{Vouchers: []Voucher{
+		{Code: "B1", FaceValue: 5000, Balance: 5000, Expiry: "2025-12-31"},
+		{Code: "B2", FaceValue: 5000, Balance: 0},
+	}}
+
+	tests := []struct {
+		name    string
+		code    string
+		date    string
+		due     int
+		want    int
+		wantErr string
+	}{
+		{name: "saldo większe niż kwota", code: "b1", date: "2025-12-01", due: 3000, want: 3000},
+		{name: "saldo mniejsze niż kwota", code: "B1", date: "2025-12-01", due: 8000, want: 5000},
+		{name: "po terminie ważności", code: "B1", date: "2026-01-01", due: 3000, wantErr: "ważny do"},
+		{name: "wykorzystany", code: "B2", date: "2025-12-01", due: 3000, wantErr: "wykorzystany"},
+		{name: "nieznany", code: "B3", date: "2025-12-01", due: 3000, wantErr: "nie znaleziono"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Available(tt.code, tt.date, tt.due)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Available = %d, %v; oczekiwano %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateVouchers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vouchers.json")
+	if _, err := UpdateVouchers(path, func(r *VoucherRegistry) error { return r.Issue("B1", 5000, "") }); err != nil {
+		t.Fatal(err)
+	}
+
+	redeem := func(amount int) error {
+		_, err := UpdateVouchers(path, func(r *VoucherRegistry) error { return r.Redeem("B1", amount) })
+		return err
+	}
+	if err := redeem(3000); err != nil {
+		t.Fatal(err)
+	}
+	// drugi proces z nieaktualnym rejestrem w pamięci nie wyda tego samego salda
+	if err := redeem(3000); err == nil {
+		t.Fatal("oczekiwano błędu niewystarczającego salda")
+	}
+
+	r, err := UpdateVouchers(path, func(r *VoucherRegistry) error { return r.Refund("B1", 3000) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.find("B1").Balance; got != 5000 {
+		t.Errorf("saldo po zwrocie = %d, oczekiwano 5000", got)
+	}
+
+	saved, err := LoadVouchers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.find("B1").Balance; got != 5000 {
+		t.Errorf("zapisane saldo = %d, oczekiwano 5000", got)
+	}
+}
+
+func TestProcessRefundsVoucherOnlyWhenNotPrinted(t *testing.T) {
+	tests := []struct {
+		name        string
+		expiry      string
+		failCmds    []string
+		wantErr     string
+		wantBalance int
+	}{
+		{name: "paragon wydrukowany", wantBalance: 0},
+		{name: "transakcja anulowana", failCmds: []string{"trpayment"}, wantErr: "transakcja anulowana", wantBalance: 5000},
+		{name: "nieudane anulowanie", failCmds: []string{"trpayment", "trcancel"}, wantErr: "błąd anulowania", wantBalance: 0},
+		{name: "bon przeterminowany przed datą z CSV", expiry: "2020-01-01", wantErr: "ważny do", wantBalance: 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, _ := newFakePrinter(t, func(cmd string) string {
+				if slices.Contains(tt.failCmds, cmd) {
+					return "?\tERR12\t"
+				}
+				return okReply(cmd)
+			})
+			s := newTestSession(t, fc, Product{Name: "Sweter", MinPrice: 100, MaxPrice: 100, Stock: 5})
+			s.cfg.Fiscal.ShippingChance = 0
+			var err error
+			s.vouchers, err = UpdateVouchers(s.paths.Vouchers, func(r *VoucherRegistry) error { return r.Issue("B1", 5000, tt.expiry) })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.Process(Transaction{Date: "2019-12-01", Amount: 10000, VoucherCode: "B1"}, 1, 1)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("błąd = %v, oczekiwano zawierającego %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("nieoczekiwany błąd: %v", err)
+			}
+
+			saved, err := LoadVouchers(s.paths.Vouchers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := saved.find("B1").Balance; got != tt.wantBalance {
+				t.Errorf("saldo = %d, oczekiwano %d", got, tt.wantBalance)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	WatchDone      = "done"
+	WatchFailed    = "failed"
+	WatchDuplicate = "duplicate"
+
+	watchProcessing = "processing"
+	watchStateFile  = ".posnet-watch.json"
+)
+
+// WatchResult opisuje przetworzenie jednego pliku; zapisywany jest obok
+// przeniesionego pliku jako <plik>.result.json.
+type WatchResult struct {
+	File     string          `json:"file"`
+	Hash     string          `json:"hash"`
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+	Receipts []*ReceiptEvent `json:"receipts,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+
+	// printed oznacza, że dokumenty z pliku mogły zostać wydrukowane; tylko
+	// wtedy skrót zostaje w rejestrze. Plik odrzucony przed drukiem można
+	// poprawić lub przenieść z powrotem do katalogu.
+	printed bool
+}
+
+// watchEntry to wpis rejestru przetworzonych plików, kluczem jest skrót
+// SHA-256 treści.
+type watchEntry struct {
+	File   string    `json:"file"`
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watcher przetwarza pliki CSV pojawiające się w katalogu i przenosi je do
+// done/ albo failed/. Plik o treści już przetworzonej nie jest drukowany
+// ponownie, a plik jest brany do druku dopiero, gdy między dwoma
+// przeglądami katalogu nie zmienił rozmiaru ani czasu modyfikacji.
+type Watcher struct {
+	dir     string
+	pattern string
+	worker  *Worker
+	out     *Output
+	dryRun  bool
+
+	state   map[string]watchEntry
+	pending map[string]fileStamp
+}
+
+func NewWatcher(dir, pattern string, worker *Worker, out *Output) (*Watcher, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("nieprawidłowy wzorzec plików %q: %w", pattern, err)
+	}
+	w := &Watcher{
+		dir:     dir,
+		pattern: pattern,
+		worker:  worker,
+		out:     out,
+		dryRun:  worker.dryRun,
+		state:   make(map[string]watchEntry),
+		pending: make(map[string]fileStamp),
+	}
+	if w.dryRun {
+		return w, nil
+	}
+
+	for _, sub := range []string{WatchDone, WatchFailed} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("błąd tworzenia katalogu %s: %w", sub, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, watchStateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("błąd odczytu rejestru przetworzonych plików: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &w.state); err != nil {
+			return nil, fmt.Errorf("błąd parsowania rejestru przetworzonych plików: %w", err)
+		}
+	}
+	return w, nil
+}
+
+func (w *Watcher) saveState() error {
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(w.dir, watchStateFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru przetworzonych plików: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("błąd zapisu rejestru przetworzonych plików: %w", err)
+	}
+	return nil
+}
+
+// Run przegląda katalog co interval do anulowania ctx; między przeglądami
+// wykonuje harmonogram i zlecenia z kolejki.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	for {
+		w.Scan(false)
+		w.worker.Tick()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Scan przetwarza gotowe pliki; z now == true pomija sprawdzenie, czy plik
+// jest jeszcze zapisywany. Zwraca liczbę plików, których nie udało się
+// przetworzyć.
+func (w *Watcher) Scan(now bool) int {
+	files, err := filepath.Glob(filepath.Join(w.dir, w.pattern))
+	if err != nil {
+		w.out.Warn("błąd przeglądania katalogu %s: %v", w.dir, err)
+		return 0
+	}
+	sort.Strings(files)
+
+	failed := 0
+	current := make(map[string]fileStamp)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+		stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+		if prev, ok := w.pending[path]; !now && (!ok || prev != stamp) {
+			current[path] = stamp
+			continue
+		}
+		if res := w.processFile(path); res.Status != WatchDone {
+			failed++
+		}
+	}
+	w.pending = current
+	return failed
+}
+
+func (w *Watcher) processFile(path string) *WatchResult {
+	res := &WatchResult{File: filepath.Base(path), Started: time.Now()}
+	w.out.Printf("\n📄 Plik %s\n", res.File)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		w.out.Warn("błąd odczytu %s: %v", path, err)
+		res.Status = WatchFailed
+		res.Error = err.Error()
+		return res
+	}
+	sum := sha256.Sum256(content)
+	res.Hash = hex.EncodeToString(sum[:])
+
+	if prev, ok := w.state[res.Hash]; ok && !w.dryRun {
+		res.Status = WatchDuplicate
+		if prev.Status == watchProcessing {
+			res.Status = WatchFailed
+			res.printed = true
+			res.Error = fmt.Sprintf("przetwarzanie pliku %s przerwane %s - sprawdź, które dokumenty zostały wydrukowane",
+				prev.File, prev.Time.Format("2006-01-02 15:04"))
+		} else {
+			res.Error = fmt.Sprintf("plik o tej samej treści (%s) przetworzono %s", prev.File, prev.Time.Format("2006-01-02 15:04"))
+		}
+		w.finish(path, res)
+		return res
+	}
+
+	transactions, warnings, err := ReadCSVFile(path)
+	res.Warnings = warnings
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+	case len(warnings) > 0:
+		res.Error = fmt.Sprintf("błędne linie w pliku: %d - plik nie został wydrukowany", len(warnings))
+	case len(transactions) == 0:
+		res.Error = "brak transakcji w pliku"
+	}
+	if res.Error != "" {
+		res.Status = WatchFailed
+		w.finish(path, res)
+		return res
+	}
+
+	if !w.dryRun {
+		w.state[res.Hash] = watchEntry{File: res.File, Status: watchProcessing, Time: res.Started}
+		if err := w.saveState(); err != nil {
+			delete(w.state, res.Hash)
+			w.out.Warn("%v", err)
+			res.Status = WatchFailed
+			res.Error = err.Error()
+			return res
+		}
+	}
+
+	printed := 0
+	err = w.worker.WithPrinter(func(session *PrintSession) error {
+		// liczniki sesji rosną tylko po wydrukowaniu dokumentu; transakcja
+		// odrzucona przed drukiem (np. błąd doboru produktów) ich nie zmienia
+		before := session.Receipts + session.Returns
+		defer func() { printed = session.Receipts + session.Returns - before }()
+
+		var lastErr error
+		grouped := GroupByDate(transactions)
+		for _, date := range GetUniqueDates(transactions) {
+			day := grouped[date]
+			session.BeginDay(date, len(day))
+			for i, trans := range day {
+				ev, err := session.Process(trans, i+1, len(day))
+				res.Receipts = append(res.Receipts, ev)
+				if err != nil {
+					lastErr = err
+				}
+			}
+			session.EndDay(date)
+		}
+		return lastErr
+	})
+	w.worker.session.Save()
+
+	res.printed = printed > 0
+	res.Status = WatchDone
+	if err != nil {
+		res.Status = WatchFailed
+		res.Error = err.Error()
+	}
+	w.finish(path, res)
+	return res
+}
+
+// finish przenosi plik do done/ albo failed/ razem z plikiem wyniku
+// i zapisuje wynik w rejestrze. W trybie testowym plik zostaje na miejscu.
+func (w *Watcher) finish(path string, res *WatchResult) {
+	res.Finished = time.Now()
+	switch res.Status {
+	case WatchDone:
+		w.out.Printf("✓ Plik %s przetworzony\n", res.File)
+	default:
+		w.out.Printf("❌ Plik %s: %s\n", res.File, res.Error)
+		for _, warning := range res.Warnings {
+			w.out.Printf("  • %s\n", warning)
+		}
+	}
+	w.out.Event("file_processed", res)
+	if w.dryRun {
+		return
+	}
+
+	if res.Status != WatchDuplicate {
+		if res.printed {
+			w.state[res.Hash] = watchEntry{File: res.File, Status: res.Status, Time: res.Finished}
+		} else {
+			delete(w.state, res.Hash)
+		}
+		if err := w.saveState(); err != nil {
+			w.out.Warn("%v", err)
+		}
+	}
+
+	sub := WatchDone
+	if res.Status != WatchDone {
+		sub = WatchFailed
+	}
+	target := filepath.Join(w.dir, sub, res.File)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(res.File)
+		target = filepath.Join(w.dir, sub, fmt.Sprintf("%s_%s%s",
+			strings.TrimSuffix(res.File, ext), res.Finished.Format("20060102-150405"), ext))
+	}
+	if err := os.Rename(path, target); err != nil {
+		w.out.Warn("nie udało się przenieść %s: %v", res.File, err)
+		return
+	}
+
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err == nil {
+		err = os.WriteFile(target+".result.json", data, 0644)
+	}
+	if err != nil {
+		w.out.Warn("nie udało się zapisać wyniku %s: %v", res.File, err)
+	}
+}
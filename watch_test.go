@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatcherKeepsHashOnlyForPrintedFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		products   []Product
+		wantStatus string
+		wantSecond string
+	}{
+		{
+			name:       "paragon wydrukowany",
+			products:   []Product{{Name: "Sweter", MinPrice: 100, MaxPrice: 100, Stock: 5}},
+			wantStatus: WatchDone,
+			wantSecond: WatchDuplicate,
+		},
+		{
+			name:       "błąd doboru produktów przed drukiem",
+			wantStatus: WatchFailed,
+			wantSecond: WatchFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, _ := newFakePrinter(t, okReply)
+			session := newTestSession(t, fc, tt.products...)
+			session.cfg.Fiscal.ShippingChance = 0
+			queue, err := OpenJobQueue(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			worker := NewWorker(queue, session.cfg, session, fc, session.out)
+			dir := t.TempDir()
+			w, err := NewWatcher(dir, "*.csv", worker, session.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			drop := func() *WatchResult {
+				path := filepath.Join(dir, "a.csv")
+				if err := os.WriteFile(path, []byte("2025-12-01; 100,00\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return w.processFile(path)
+			}
+
+			if res := drop(); res.Status != tt.wantStatus {
+				t.Fatalf("status = %s (%s), oczekiwano %s", res.Status, res.Error, tt.wantStatus)
+			}
+			// ponownie wrzucony plik jest duplikatem tylko, gdy coś wydrukowano
+			if res := drop(); res.Status != tt.wantSecond {
+				t.Errorf("ponowny plik: status = %s (%s), oczekiwano %s", res.Status, res.Error, tt.wantSecond)
+			}
+		})
+	}
+}